@@ -0,0 +1,533 @@
+package netting
+
+import (
+    "errors"
+    "fmt"
+    "math"
+    "sort"
+    "strings"
+)
+
+// Amount is a numeric representation that an AmountGraph can net with
+type Amount[A any] interface {
+    // Add returns the sum, or an error if it cannot be represented
+    Add(A) (A, error)
+    // Sub returns the receiver minus the argument, or an error if that
+    // cannot be represented
+    Sub(A) (A, error)
+    // Min returns the smaller of the receiver and the argument
+    Min(A) A
+    // IsZero reports whether the amount is zero
+    IsZero() bool
+}
+
+// Uint64Amount is a uint64 as an Amount, for netting in an AmountGraph the
+// amounts a Graph holds
+type Uint64Amount uint64
+
+func (a Uint64Amount) Add(b Uint64Amount) (Uint64Amount, error) {
+    if a > math.MaxUint64-b {
+        return 0, ErrAmountOverflow
+    }
+    return a + b, nil
+}
+
+func (a Uint64Amount) Sub(b Uint64Amount) (Uint64Amount, error) {
+    if b > a {
+        return 0, fmt.Errorf("cannot subtract %d from %d", b, a)
+    }
+    return a - b, nil
+}
+
+func (a Uint64Amount) Min(b Uint64Amount) Uint64Amount {
+    if b < a {
+        return b
+    }
+    return a
+}
+
+func (a Uint64Amount) IsZero() bool {
+    return a == 0
+}
+
+// ErrDecimalOverflow is returned when a Decimal result does not fit in an
+// int64 at the required scale
+var ErrDecimalOverflow = errors.New("decimal overflows int64")
+
+// Decimal is a fixed-point amount of Units / 10^Scale. Operands with
+// different scales are brought to the larger scale first, so no precision
+// is lost.
+type Decimal struct {
+    Units int64
+    Scale uint8
+}
+
+// rescale returns d's units at a scale of at least d.Scale
+func (d Decimal) rescale(scale uint8) (int64, error) {
+    units := d.Units
+    for s := d.Scale; s < scale; s++ {
+        if units > math.MaxInt64/10 || units < math.MinInt64/10 {
+            return 0, ErrDecimalOverflow
+        }
+        units *= 10
+    }
+    return units, nil
+}
+
+// align returns the units of d and e at their common scale
+func (d Decimal) align(e Decimal) (int64, int64, uint8, error) {
+    scale := d.Scale
+    if e.Scale > scale {
+        scale = e.Scale
+    }
+    a, err := d.rescale(scale)
+    if err != nil {
+        return 0, 0, 0, err
+    }
+    b, err := e.rescale(scale)
+    if err != nil {
+        return 0, 0, 0, err
+    }
+    return a, b, scale, nil
+}
+
+func (d Decimal) Add(e Decimal) (Decimal, error) {
+    a, b, scale, err := d.align(e)
+    if err != nil {
+        return Decimal{}, err
+    }
+    if (b > 0 && a > math.MaxInt64-b) || (b < 0 && a < math.MinInt64-b) {
+        return Decimal{}, ErrDecimalOverflow
+    }
+    return Decimal{Units: a + b, Scale: scale}, nil
+}
+
+// Sub fails with ErrDecimalOverflow if the result does not fit at the
+// common scale, such as a whole amount less a tiny fraction
+func (d Decimal) Sub(e Decimal) (Decimal, error) {
+    a, b, scale, err := d.align(e)
+    if err != nil {
+        return Decimal{}, err
+    }
+    if (b < 0 && a > math.MaxInt64+b) || (b > 0 && a < math.MinInt64+b) {
+        return Decimal{}, ErrDecimalOverflow
+    }
+    return Decimal{Units: a - b, Scale: scale}, nil
+}
+
+// Min compares at the common scale. If that overflows, the operand with the
+// smaller scale has the larger magnitude, so for the non-negative amounts
+// netting deals in the other one is returned.
+func (d Decimal) Min(e Decimal) Decimal {
+    a, b, _, err := d.align(e)
+    if err != nil {
+        if d.Scale > e.Scale {
+            return d
+        }
+        return e
+    }
+    if b < a {
+        return e
+    }
+    return d
+}
+
+func (d Decimal) IsZero() bool {
+    return d.Units == 0
+}
+
+// Sign returns -1, 0 or 1 as d is negative, zero or positive
+func (d Decimal) Sign() int {
+    switch {
+    case d.Units < 0:
+        return -1
+    case d.Units > 0:
+        return 1
+    }
+    return 0
+}
+
+func (d Decimal) String() string {
+    units := d.Units
+    sign := ""
+    if units < 0 {
+        sign = "-"
+    }
+    mag := magnitude(units)
+    if d.Scale == 0 {
+        return fmt.Sprintf("%s%d", sign, mag)
+    }
+    pow := uint64(1)
+    for s := uint8(0); s < d.Scale && pow <= math.MaxUint64/10; s++ {
+        pow *= 10
+    }
+    return fmt.Sprintf("%s%d.%0*d", sign, mag/pow, int(d.Scale), mag%pow)
+}
+
+// ParseDecimal parses a decimal string such as "12.5" or "-0.01" at the
+// given scale. Up to scale fractional digits are accepted; more would need
+// rounding, so they are rejected rather than silently dropped.
+func ParseDecimal(s string, scale uint8) (Decimal, error) {
+    digits := s
+    negative := false
+    if digits != "" && (digits[0] == '-' || digits[0] == '+') {
+        negative = digits[0] == '-'
+        digits = digits[1:]
+    }
+    whole, frac, _ := strings.Cut(digits, ".")
+    if whole == "" && frac == "" {
+        return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+    }
+    if len(frac) > int(scale) {
+        return Decimal{}, fmt.Errorf("decimal %q has more than %d fractional digits", s, scale)
+    }
+
+    // Accumulate as a negative number, whose range includes MinInt64
+    var units int64
+    for _, part := range []string{whole, frac + strings.Repeat("0", int(scale)-len(frac))} {
+        for _, c := range part {
+            if c < '0' || c > '9' {
+                return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+            }
+            d := int64(c - '0')
+            if units < (math.MinInt64+d)/10 {
+                return Decimal{}, fmt.Errorf("decimal %q: %w", s, ErrDecimalOverflow)
+            }
+            units = units*10 - d
+        }
+    }
+    if !negative {
+        if units == math.MinInt64 {
+            return Decimal{}, fmt.Errorf("decimal %q: %w", s, ErrDecimalOverflow)
+        }
+        units = -units
+    }
+    return Decimal{Units: units, Scale: scale}, nil
+}
+
+// ErrScale is returned when a Decimal does not have the scale of its token
+var ErrScale = errors.New("decimal scale does not match token")
+
+// Scales gives the number of decimal places of each token, so amounts can
+// be written in display units. Tokens without an entry have scale 0.
+type Scales map[string]uint8
+
+// Check returns an error wrapping ErrScale unless d has token's scale
+func (s Scales) Check(token string, d Decimal) error {
+    if d.Scale != s[token] {
+        return fmt.Errorf("%s amount %v has %d places, want %d: %w", token, d, d.Scale, s[token], ErrScale)
+    }
+    return nil
+}
+
+// Parse reads an amount of token in display units
+func (s Scales) Parse(token, amount string) (Decimal, error) {
+    return ParseDecimal(amount, s[token])
+}
+
+// Format writes d in token's display units. An amount with more fractional
+// digits than the token has is written at its own scale instead, so nothing
+// is lost.
+func (s Scales) Format(token string, d Decimal) string {
+    if d.Scale < s[token] {
+        if units, err := d.rescale(s[token]); err == nil {
+            d = Decimal{Units: units, Scale: s[token]}
+        }
+    }
+    return d.String()
+}
+
+// negative reports whether a is below zero, for representations with a Sign
+// method
+func negative[A any](a A) bool {
+    s, ok := any(a).(interface{ Sign() int })
+    return ok && s.Sign() < 0
+}
+
+// AmountIntent is an Intent carrying an arbitrary Amount
+type AmountIntent[A Amount[A]] struct {
+    Sender    string
+    Receiver  string
+    Token     string
+    Amount    A
+}
+
+// AmountEdge is an Edge carrying an arbitrary Amount
+type AmountEdge[A Amount[A]] struct {
+    To     string
+    Token  string
+    Amount A
+}
+
+// AmountGraph is a debt network for any Amount representation, separate
+// from Graph. Its netting only uses the Amount methods, so it is shared by
+// every representation, GraphBig included, but it has only the basic cycle
+// netting of ProcessNetting: none of the Options, bilateral netting or
+// other Graph methods apply to it.
+type AmountGraph[A Amount[A]] struct {
+    // map[from][]AmountEdge
+    Edges map[string][]AmountEdge[A]
+
+    // check, if set, vets every amount added or netted
+    check func(token string, amount A) error
+}
+
+func NewAmountGraph[A Amount[A]]() *AmountGraph[A] {
+    return &AmountGraph[A]{
+        Edges: make(map[string][]AmountEdge[A]),
+    }
+}
+
+// NewDecimalGraph returns an AmountGraph that only takes amounts at the
+// scale scales gives their token, failing with ErrScale otherwise. Decimal
+// arithmetic at one scale stays at it, so netting never rounds.
+func NewDecimalGraph(scales Scales) *AmountGraph[Decimal] {
+    g := NewAmountGraph[Decimal]()
+    g.check = scales.Check
+    return g
+}
+
+// Add or update edge in the graph. If amount is negative, rejected by the
+// graph or Add fails the edge is left untouched and an error is returned.
+func (g *AmountGraph[A]) AddEdge(from, to, token string, amount A) error {
+    if from == to {
+        return ErrSelfLoop
+    }
+    if negative(amount) {
+        return fmt.Errorf("negative amount %v", amount)
+    }
+    if g.check != nil {
+        if err := g.check(token, amount); err != nil {
+            return err
+        }
+    }
+    for i, edge := range g.Edges[from] {
+        if edge.To == to && edge.Token == token {
+            sum, err := edge.Amount.Add(amount)
+            if err != nil {
+                return err
+            }
+            g.Edges[from][i].Amount = sum
+            return nil
+        }
+    }
+    g.Edges[from] = append(g.Edges[from], AmountEdge[A]{To: to, Token: token, Amount: amount})
+    return nil
+}
+
+// topology returns a Graph with the same edges as g so the SCC and cycle
+// search can be shared. Amounts in it are meaningless.
+func (g *AmountGraph[A]) topology() *Graph {
+    froms := make([]string, 0, len(g.Edges))
+    for from := range g.Edges {
+        froms = append(froms, from)
+    }
+    sort.Strings(froms)
+
+    t := NewGraph()
+    for _, from := range froms {
+        for _, edge := range g.Edges[from] {
+            t.AddEdge(from, edge.To, edge.Token, 1)
+        }
+    }
+    return t
+}
+
+func (g *AmountGraph[A]) FindSCCs() [][]string {
+    return g.topology().FindSCCs()
+}
+
+func (g *AmountGraph[A]) FindCycles(scc []string, maxLength int) [][]string {
+    return g.topology().FindCycles(scc, maxLength)
+}
+
+// findEdge returns the edge from -> to for token, or nil if there is none
+func (g *AmountGraph[A]) findEdge(from, to, token string) *AmountEdge[A] {
+    for i, edge := range g.Edges[from] {
+        if edge.To == to && edge.Token == token {
+            return &g.Edges[from][i]
+        }
+    }
+    return nil
+}
+
+// Calculate netting amount for a cycle. The bool is false if some hop in
+// the cycle has no edge for token, in which case nothing can be netted.
+func (g *AmountGraph[A]) CalculateNetting(cycle []string, token string) (A, bool) {
+    var minAmount A
+    for i := 0; i < len(cycle); i++ {
+        edge := g.findEdge(cycle[i], cycle[(i+1)%len(cycle)], token)
+        if edge == nil {
+            var none A
+            return none, false
+        }
+        if i == 0 {
+            minAmount = edge.Amount
+        } else {
+            minAmount = minAmount.Min(edge.Amount)
+        }
+    }
+    return minAmount, len(cycle) > 0
+}
+
+// ApplyNetting subtracts amount from every edge in the cycle. Edges that
+// reach zero are removed from the graph. Every hop is worked out first, so
+// if amount is not positive or rejected by the graph, an edge is missing or
+// a subtraction fails, whether because the edge is too small or the result
+// cannot be represented, the graph is left unchanged and the error is
+// returned.
+func (g *AmountGraph[A]) ApplyNetting(cycle []string, token string, amount A) error {
+    if amount.IsZero() || negative(amount) {
+        return fmt.Errorf("cannot net %v: amount must be positive", amount)
+    }
+    if g.check != nil {
+        if err := g.check(token, amount); err != nil {
+            return err
+        }
+    }
+
+    // A hop listed more than once is reduced once per listing
+    left := make(map[*AmountEdge[A]]A, len(cycle))
+    froms := make(map[*AmountEdge[A]]string, len(cycle))
+    for i := 0; i < len(cycle); i++ {
+        from, to := cycle[i], cycle[(i+1)%len(cycle)]
+        edge := g.findEdge(from, to, token)
+        if edge == nil {
+            return fmt.Errorf("no %s edge %s -> %s", token, from, to)
+        }
+        have, ok := left[edge]
+        if !ok {
+            have = edge.Amount
+        }
+        rest, err := have.Sub(amount)
+        if err != nil {
+            return fmt.Errorf("%s edge %s -> %s: %w", token, from, to, err)
+        }
+        if negative(rest) {
+            return fmt.Errorf("%s edge %s -> %s holds %v, cannot net %v", token, from, to, edge.Amount, amount)
+        }
+        left[edge] = rest
+        froms[edge] = from
+    }
+
+    // Amounts are all set before any edge is removed, which moves the
+    // edges the pointers refer to
+    emptied := make(map[string]bool)
+    for edge, rest := range left {
+        edge.Amount = rest
+        if rest.IsZero() {
+            emptied[froms[edge]] = true
+        }
+    }
+    for from := range emptied {
+        kept := g.Edges[from][:0]
+        for _, e := range g.Edges[from] {
+            if !e.Amount.IsZero() {
+                kept = append(kept, e)
+            }
+        }
+        if len(kept) == 0 {
+            delete(g.Edges, from)
+        } else {
+            g.Edges[from] = kept
+        }
+    }
+    return nil
+}
+
+// ToIntents returns the remaining debts, sorted by sender, receiver and token
+func (g *AmountGraph[A]) ToIntents() []AmountIntent[A] {
+    intents := make([]AmountIntent[A], 0)
+    for from, edges := range g.Edges {
+        for _, edge := range edges {
+            if !edge.Amount.IsZero() {
+                intents = append(intents, AmountIntent[A]{
+                    Sender:    from,
+                    Receiver:  edge.To,
+                    Token:     edge.Token,
+                    Amount:    edge.Amount,
+                })
+            }
+        }
+    }
+
+    sort.Slice(intents, func(i, j int) bool {
+        a, b := intents[i], intents[j]
+        if a.Sender != b.Sender {
+            return a.Sender < b.Sender
+        }
+        if a.Receiver != b.Receiver {
+            return a.Receiver < b.Receiver
+        }
+        return a.Token < b.Token
+    })
+    return intents
+}
+
+// ProcessNettingAmount is ProcessNetting for any Amount representation.
+// Amounts must be nonzero, and positive if the representation has a Sign
+// method; self-loops are dropped. A cycle whose netting cannot be
+// represented, for example because its amount has more decimal places than
+// an edge can take on at its size, is left as it is.
+func ProcessNettingAmount[A Amount[A]](intents []AmountIntent[A]) ([]AmountIntent[A], error) {
+    return NewAmountGraph[A]().net(intents)
+}
+
+// ProcessNettingDecimal is ProcessNettingAmount for Decimals, which must
+// have the scale scales gives their token. An amount at any other scale
+// fails with ErrScale.
+func ProcessNettingDecimal(intents []AmountIntent[Decimal], scales Scales) ([]AmountIntent[Decimal], error) {
+    return NewDecimalGraph(scales).net(intents)
+}
+
+// net adds intents to the empty graph g and nets it as ProcessNettingAmount
+// describes
+func (g *AmountGraph[A]) net(intents []AmountIntent[A]) ([]AmountIntent[A], error) {
+    for i, intent := range intents {
+        if err := validateIntent(Intent{
+            Sender:    intent.Sender,
+            Receiver:  intent.Receiver,
+            Token:     intent.Token,
+            Amount:    1,
+        }); err != nil {
+            return nil, fmt.Errorf("intent %d: %w", i, err)
+        }
+        if intent.Amount.IsZero() {
+            return nil, fmt.Errorf("intent %d: zero amount", i)
+        }
+        if negative(intent.Amount) {
+            return nil, fmt.Errorf("intent %d: negative amount", i)
+        }
+        if intent.Sender == intent.Receiver {
+            continue
+        }
+        if err := g.AddEdge(intent.Sender, intent.Receiver, intent.Token, intent.Amount); err != nil {
+            return nil, fmt.Errorf("intent %d: %w", i, err)
+        }
+    }
+
+    t := g.topology()
+    for _, scc := range t.FindSCCs() {
+        for _, cycle := range t.FindCycles(scc, DefaultMaxCycleLength) {
+            // Any token nettable around the cycle must be on its first hop
+            tokens := make([]string, 0)
+            for _, edge := range g.Edges[cycle[0]] {
+                if edge.To == cycle[1%len(cycle)] {
+                    tokens = append(tokens, edge.Token)
+                }
+            }
+            sort.Strings(tokens)
+
+            for _, token := range tokens {
+                // A netting the representation cannot hold, such as a
+                // fraction off a large whole amount, is skipped
+                amount, ok := g.CalculateNetting(cycle, token)
+                if ok && !amount.IsZero() {
+                    g.ApplyNetting(cycle, token, amount)
+                }
+            }
+        }
+    }
+
+    return g.ToIntents(), nil
+}
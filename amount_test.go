@@ -0,0 +1,158 @@
+package netting
+
+import (
+    "errors"
+    "testing"
+)
+
+func TestProcessNettingAmountUint64AndDecimal(t *testing.T) {
+    // The same debts in cents, as uint64 and as 2-place decimals
+    type debt struct {
+        from, to string
+        cents    int64
+    }
+    debts := []debt{
+        {"A", "B", 1050}, {"B", "C", 725}, {"C", "A", 900},
+        {"B", "A", 100}, {"C", "D", 333},
+    }
+    var whole []AmountIntent[Uint64Amount]
+    var fixed []AmountIntent[Decimal]
+    for _, d := range debts {
+        whole = append(whole, AmountIntent[Uint64Amount]{Sender: d.from, Receiver: d.to, Token: "USD", Amount: Uint64Amount(d.cents)})
+        fixed = append(fixed, AmountIntent[Decimal]{Sender: d.from, Receiver: d.to, Token: "USD", Amount: Decimal{Units: d.cents, Scale: 2}})
+    }
+
+    gotWhole, err := ProcessNettingAmount(whole)
+    if err != nil {
+        t.Fatal(err)
+    }
+    gotFixed, err := ProcessNettingAmount(fixed)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(gotWhole) != len(gotFixed) {
+        t.Fatalf("uint64 left %v, decimal %v", gotWhole, gotFixed)
+    }
+    for i := range gotWhole {
+        w, f := gotWhole[i], gotFixed[i]
+        if w.Sender != f.Sender || w.Receiver != f.Receiver || f.Amount.Scale != 2 || int64(w.Amount) != f.Amount.Units {
+            t.Errorf("residual %d: uint64 %v, decimal %v", i, w, f)
+        }
+    }
+
+    // The uint64 run must agree with Graph itself
+    var plain []Intent
+    for _, d := range debts {
+        plain = append(plain, Intent{Sender: d.from, Receiver: d.to, Token: "USD", Amount: uint64(d.cents)})
+    }
+    want, err := ProcessNetting(plain)
+    if err != nil {
+        t.Fatal(err)
+    }
+    same := len(want) == len(gotWhole)
+    for i := 0; same && i < len(want); i++ {
+        w := gotWhole[i]
+        same = want[i].Sender == w.Sender && want[i].Receiver == w.Receiver && want[i].Amount == uint64(w.Amount)
+    }
+    if !same {
+        t.Errorf("Graph left %v, AmountGraph %v", want, gotWhole)
+    }
+}
+
+func TestProcessNettingAmountUnrepresentable(t *testing.T) {
+    // Taking 5e-18 off 1e11 needs 1e29 units of 10^-18, beyond an int64
+    intents := []AmountIntent[Decimal]{
+        {Sender: "A", Receiver: "B", Token: "T", Amount: Decimal{Units: 1e11}},
+        {Sender: "B", Receiver: "A", Token: "T", Amount: Decimal{Units: 5, Scale: 18}},
+    }
+    out, err := ProcessNettingAmount(intents)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(out) != 2 || out[0].Amount != intents[0].Amount || out[1].Amount != intents[1].Amount {
+        t.Errorf("ProcessNettingAmount = %v, want the debts left as they were", out)
+    }
+
+    if _, err := (Decimal{Units: 1e11}).Sub(Decimal{Units: 5, Scale: 18}); err == nil {
+        t.Error("Sub succeeded beyond int64")
+    }
+}
+
+func TestDecimalNoDrift(t *testing.T) {
+    scales := Scales{"USD": 2}
+    parse := func(s string) Decimal {
+        d, err := scales.Parse("USD", s)
+        if err != nil {
+            t.Fatal(err)
+        }
+        return d
+    }
+
+    g := NewDecimalGraph(scales)
+    for _, d := range []struct{ from, to, amount string }{
+        {"A", "B", "12.50"}, {"B", "C", "10.3"}, {"C", "A", "10.20"},
+    } {
+        if err := g.AddEdge(d.from, d.to, "USD", parse(d.amount)); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    // A hundred rounds netting 0.10 each; as float64 the tenths would sum
+    // to 9.99999999999998
+    cycle := []string{"A", "B", "C"}
+    for round := 0; round < 100; round++ {
+        if err := g.ApplyNetting(cycle, "USD", parse("0.1")); err != nil {
+            t.Fatalf("round %d: %v", round, err)
+        }
+    }
+    check := func(want map[string]string) {
+        t.Helper()
+        got := g.ToIntents()
+        if len(got) != len(want) {
+            t.Fatalf("edges = %v, want %v", got, want)
+        }
+        for _, intent := range got {
+            key := intent.Sender + "->" + intent.Receiver
+            if s := scales.Format("USD", intent.Amount); s != want[key] || intent.Amount.Scale != 2 {
+                t.Errorf("%s = %s at scale %d, want %s at scale 2", key, s, intent.Amount.Scale, want[key])
+            }
+        }
+    }
+    check(map[string]string{"A->B": "2.50", "B->C": "0.30", "C->A": "0.20"})
+
+    // What is left nets C -> A away exactly
+    amount, ok := g.CalculateNetting(cycle, "USD")
+    if !ok || amount != parse("0.20") {
+        t.Fatalf("CalculateNetting = %v, %v, want 0.20", amount, ok)
+    }
+    if err := g.ApplyNetting(cycle, "USD", amount); err != nil {
+        t.Fatal(err)
+    }
+    check(map[string]string{"A->B": "2.30", "B->C": "0.10"})
+
+    // Amounts at another scale are refused, not mixed in
+    if err := g.AddEdge("A", "B", "USD", Decimal{Units: 1, Scale: 3}); !errors.Is(err, ErrScale) {
+        t.Errorf("AddEdge at scale 3 = %v, want ErrScale", err)
+    }
+    if err := g.ApplyNetting([]string{"A", "B"}, "USD", Decimal{Units: 1, Scale: 1}); !errors.Is(err, ErrScale) {
+        t.Errorf("ApplyNetting at scale 1 = %v, want ErrScale", err)
+    }
+    check(map[string]string{"A->B": "2.30", "B->C": "0.10"})
+    _, err := ProcessNettingDecimal([]AmountIntent[Decimal]{
+        {Sender: "A", Receiver: "B", Token: "USD", Amount: parse("1")},
+        {Sender: "B", Receiver: "A", Token: "USD", Amount: Decimal{Units: 1}},
+    }, scales)
+    if !errors.Is(err, ErrScale) {
+        t.Errorf("ProcessNettingDecimal with a whole amount = %v, want ErrScale", err)
+    }
+
+    for _, s := range []string{"12.5", "-0.01", "0"} {
+        d := parse(s)
+        if back := parse(scales.Format("USD", d)); back != d {
+            t.Errorf("%s: round trip gave %v, want %v", s, back, d)
+        }
+    }
+    if _, err := scales.Parse("USD", "1.001"); err == nil {
+        t.Error("Parse accepted more places than the token has")
+    }
+}
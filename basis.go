@@ -0,0 +1,100 @@
+package netting
+
+// CycleBasis returns a fundamental cycle basis of the edges in token, taken
+// as an undirected graph: a spanning forest is grown breadth-first from each
+// node in sorted order, and every edge outside it closes one cycle with the
+// forest path between its ends. There are edges - nodes + components cycles,
+// and every cycle in token is a sum of them. Each cycle lists its nodes in
+// order, starting with the sender and then the receiver of the edge that
+// closes it; the other hops follow the forest and may run against the
+// direction of debt, so a basis cycle is not necessarily nettable as is.
+func (g *GraphOf[N]) CycleBasis(token string) [][]N {
+    // Undirected adjacency, with each edge numbered in edge order
+    type link struct {
+        to   N
+        edge int
+    }
+    type arc struct{ from, to N }
+    var arcs []arc
+    adjacent := make(map[N][]link)
+    nodes := make([]N, 0)
+    for _, from := range g.sources() {
+        for _, edge := range g.Edges[from] {
+            if edge.Token != token {
+                continue
+            }
+            for _, v := range []N{from, edge.To} {
+                if _, ok := adjacent[v]; !ok {
+                    adjacent[v] = nil
+                    nodes = append(nodes, v)
+                }
+            }
+            adjacent[from] = append(adjacent[from], link{edge.To, len(arcs)})
+            adjacent[edge.To] = append(adjacent[edge.To], link{from, len(arcs)})
+            arcs = append(arcs, arc{from, edge.To})
+        }
+    }
+    g.sortNodes(nodes)
+
+    // Breadth-first spanning forest
+    parent := make(map[N]N)
+    depth := make(map[N]int)
+    tree := make([]bool, len(arcs))
+    for _, root := range nodes {
+        if _, seen := depth[root]; seen {
+            continue
+        }
+        depth[root] = 0
+        queue := []N{root}
+        for len(queue) > 0 {
+            v := queue[0]
+            queue = queue[1:]
+            for _, l := range adjacent[v] {
+                if _, seen := depth[l.to]; !seen {
+                    depth[l.to] = depth[v] + 1
+                    parent[l.to] = v
+                    tree[l.edge] = true
+                    queue = append(queue, l.to)
+                }
+            }
+        }
+    }
+
+    basis := make([][]N, 0)
+    for i, a := range arcs {
+        if tree[i] {
+            continue
+        }
+
+        // Walk both ends up to their lowest common ancestor
+        var up, down []N
+        x, y := a.to, a.from
+        for depth[x] > depth[y] {
+            up = append(up, x)
+            x = parent[x]
+        }
+        for depth[y] > depth[x] {
+            down = append(down, y)
+            y = parent[y]
+        }
+        for x != y {
+            up = append(up, x)
+            down = append(down, y)
+            x, y = parent[x], parent[y]
+        }
+
+        // The path runs receiver ... ancestor ... sender; the sender leads
+        cycle := []N{a.from}
+        cycle = append(cycle, up...)
+        cycle = append(cycle, x)
+        for j := len(down) - 1; j > 0; j-- {
+            cycle = append(cycle, down[j])
+        }
+        if len(down) == 0 {
+            // The sender is the ancestor itself and already leads
+            cycle = cycle[:len(cycle)-1]
+        }
+        basis = append(basis, cycle)
+    }
+    return basis
+}
@@ -0,0 +1,69 @@
+package netting
+
+import (
+    "math/rand"
+    "testing"
+)
+
+func TestCycleBasisSize(t *testing.T) {
+    graphs := [][]Intent{
+        triangle("t0", 5),
+        // A pair owing each other is a cycle of two parallel edges
+        {{Sender: "A", Receiver: "B", Token: "t0", Amount: 1}, {Sender: "B", Receiver: "A", Token: "t0", Amount: 1}},
+    }
+    r := rand.New(rand.NewSource(6))
+    for i := 0; i < 10; i++ {
+        graphs = append(graphs, randomIntents(r, 12, 2, 5+3*i))
+    }
+
+    for i, intents := range graphs {
+        g, _, err := buildGraph(intents)
+        if err != nil {
+            t.Fatal(err)
+        }
+
+        // Count edges, nodes and components of t0 with a union-find
+        root := make(map[string]string)
+        var find func(v string) string
+        find = func(v string) string {
+            if root[v] != v {
+                root[v] = find(root[v])
+            }
+            return root[v]
+        }
+        edges, components := 0, 0
+        adjacent := make(map[[2]string]bool)
+        for from, out := range g.Edges {
+            for _, edge := range out {
+                if edge.Token != "t0" {
+                    continue
+                }
+                edges++
+                adjacent[[2]string{from, edge.To}] = true
+                adjacent[[2]string{edge.To, from}] = true
+                for _, v := range []string{from, edge.To} {
+                    if _, ok := root[v]; !ok {
+                        root[v] = v
+                        components++
+                    }
+                }
+                if a, b := find(from), find(edge.To); a != b {
+                    root[a] = b
+                    components--
+                }
+            }
+        }
+
+        basis := g.CycleBasis("t0")
+        if want := edges - len(root) + components; len(basis) != want {
+            t.Errorf("graph %d: %d basis cycles, want %d edges - %d nodes + %d components = %d", i, len(basis), edges, len(root), components, want)
+        }
+        for _, cycle := range basis {
+            for j, v := range cycle {
+                if w := cycle[(j+1)%len(cycle)]; !adjacent[[2]string{v, w}] {
+                    t.Errorf("graph %d: basis cycle %v has no edge between %s and %s", i, cycle, v, w)
+                }
+            }
+        }
+    }
+}
@@ -0,0 +1,250 @@
+package netting
+
+import (
+    "context"
+    "fmt"
+    "io"
+    "log"
+    "math/rand"
+    "testing"
+)
+
+// complete returns the complete graph on n nodes in one token, with edge
+// amounts varied so netting order matters
+func complete(n int) []Intent {
+    intents := make([]Intent, 0, n*(n-1))
+    for i := 0; i < n; i++ {
+        for j := 0; j < n; j++ {
+            if i != j {
+                intents = append(intents, Intent{
+                    Sender:   fmt.Sprintf("n%d", i),
+                    Receiver: fmt.Sprintf("n%d", j),
+                    Token:    "T",
+                    Amount:   uint64(100 + (i*7+j*13)%50),
+                })
+            }
+        }
+    }
+    return intents
+}
+
+// BenchmarkMaxCyclesK8 searches K8, which has over 8000 cycles of up to 8
+// hops, with and without a cap
+func BenchmarkMaxCyclesK8(b *testing.B) {
+    g, _, err := buildGraph(complete(8))
+    if err != nil {
+        b.Fatal(err)
+    }
+    scc := g.FindSCCs()[0]
+    for _, cap := range []int{0, 1000, 100} {
+        b.Run(fmt.Sprintf("cap=%d", cap), func(b *testing.B) {
+            b.ReportAllocs()
+            for i := 0; i < b.N; i++ {
+                if _, err := g.findCycles(context.Background(), scc, 8, cap); err != nil {
+                    b.Fatal(err)
+                }
+            }
+        })
+    }
+}
+
+func BenchmarkProcessNetting(b *testing.B) {
+    for _, nodes := range []int{10, 100, 1000} {
+        // Average intents per participant
+        for _, density := range []int{2, 8} {
+            intents := randomIntents(rand.New(rand.NewSource(1)), nodes, 3, nodes*density)
+            b.Run(fmt.Sprintf("nodes=%d/density=%d", nodes, density), func(b *testing.B) {
+                b.ReportAllocs()
+                for i := 0; i < b.N; i++ {
+                    if _, err := ProcessNetting(intents); err != nil {
+                        b.Fatal(err)
+                    }
+                }
+            })
+        }
+    }
+}
+
+// BenchmarkFindCyclesDenseSCC is the worst case for the cycle search: a
+// complete graph, every node in one SCC
+func BenchmarkFindCyclesDenseSCC(b *testing.B) {
+    for _, n := range []int{6, 8, 10} {
+        g, _, err := buildGraph(complete(n))
+        if err != nil {
+            b.Fatal(err)
+        }
+        scc := g.FindSCCs()[0]
+        b.Run(fmt.Sprintf("K%d", n), func(b *testing.B) {
+            b.ReportAllocs()
+            for i := 0; i < b.N; i++ {
+                g.FindCycles(scc, DefaultMaxCycleLength)
+            }
+        })
+    }
+}
+
+// BenchmarkStarAddEdge adds to the edges of a hub owing 50k leaves, the case
+// the per-node index is for. The scan case looks each edge up by walking
+// the hub's edge slice, as AddEdge did before the index.
+func BenchmarkStarAddEdge(b *testing.B) {
+    const leaves = 50000
+    g := NewGraph()
+    names := make([]string, leaves)
+    for i := range names {
+        names[i] = fmt.Sprintf("leaf%d", i)
+        if err := g.AddEdge("hub", names[i], "T", 1); err != nil {
+            b.Fatal(err)
+        }
+    }
+
+    b.Run("index", func(b *testing.B) {
+        b.ReportAllocs()
+        for i := 0; i < b.N; i++ {
+            if err := g.AddEdge("hub", names[i%leaves], "T", 1); err != nil {
+                b.Fatal(err)
+            }
+        }
+    })
+    b.Run("scan", func(b *testing.B) {
+        b.ReportAllocs()
+        for i := 0; i < b.N; i++ {
+            to := names[i%leaves]
+            for j := range g.Edges["hub"] {
+                if edge := &g.Edges["hub"][j]; edge.To == to && edge.Token == "T" {
+                    edge.Amount++
+                    break
+                }
+            }
+        }
+    })
+}
+
+// BenchmarkWorkersTenTokens nets ten tokens' worth of dense debts with and
+// without a worker per token
+func BenchmarkWorkersTenTokens(b *testing.B) {
+    intents := randomIntents(rand.New(rand.NewSource(1)), 100, 10, 8000)
+    for _, workers := range []int{0, 2, 4, 10} {
+        b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+            b.ReportAllocs()
+            for i := 0; i < b.N; i++ {
+                if _, err := ProcessNettingWithOptions(intents, Options{Workers: workers}); err != nil {
+                    b.Fatal(err)
+                }
+            }
+        })
+    }
+}
+
+// BenchmarkSettleAfterOneEdge settles an engine holding 200 rings after one
+// edge is added to one of them. Each ring of 20 has chords skipping a node,
+// so it is one SCC full of paths but has no cycle of up to 8 hops and nets
+// nothing. The full case forgets which participants were touched,
+// as if the engine searched every SCC on each call. What the incremental case
+// still spends goes on finding SCCs and sorting the residual intents.
+func BenchmarkSettleAfterOneEdge(b *testing.B) {
+    const rings, size = 200, 20
+    e, err := NewNettingEngineWithOptions(Options{MaxCycleLength: 8})
+    if err != nil {
+        b.Fatal(err)
+    }
+    node := func(ring, i int) string { return fmt.Sprintf("r%d.%d", ring, i%size) }
+    for r := 0; r < rings; r++ {
+        for i := 0; i < size; i++ {
+            for _, step := range []int{1, 2} {
+                if err := e.AddIntent(Intent{Sender: node(r, i), Receiver: node(r, i+step), Token: "T", Amount: 100}); err != nil {
+                    b.Fatal(err)
+                }
+            }
+        }
+    }
+    e.Settle()
+
+    for _, full := range []bool{false, true} {
+        name := "incremental"
+        if full {
+            name = "full"
+        }
+        b.Run(name, func(b *testing.B) {
+            b.ReportAllocs()
+            for i := 0; i < b.N; i++ {
+                if err := e.AddIntent(Intent{Sender: node(0, i), Receiver: node(0, i+1), Token: "T", Amount: 1}); err != nil {
+                    b.Fatal(err)
+                }
+                if full {
+                    e.touched = nil
+                }
+                e.Settle()
+            }
+        })
+    }
+}
+
+// ladderTrap returns a hub h with spokes of 50 participants it trades with
+// both ways and a ladder of levels two participants wide, each owing both of
+// the next level, that h feeds and that pays back to h. Searching from a
+// spoke, every path down the ladder leads back to h, already on the path,
+// so none closes a cycle.
+func ladderTrap(levels int) []Intent {
+    var intents []Intent
+    owe := func(from, to string) {
+        intents = append(intents, Intent{Sender: from, Receiver: to, Token: "T", Amount: 1})
+    }
+    owe("h", "x0")
+    owe("h", "y0")
+    for i := 0; i < levels-1; i++ {
+        for _, from := range []string{"x", "y"} {
+            owe(fmt.Sprintf("%s%d", from, i), fmt.Sprintf("x%d", i+1))
+            owe(fmt.Sprintf("%s%d", from, i), fmt.Sprintf("y%d", i+1))
+        }
+    }
+    owe(fmt.Sprintf("x%d", levels-1), "h")
+    owe(fmt.Sprintf("y%d", levels-1), "h")
+    for i := 0; i < 50; i++ {
+        owe(fmt.Sprintf("s%d", i), "h")
+        owe("h", fmt.Sprintf("s%d", i))
+    }
+    return intents
+}
+
+// BenchmarkFindCyclesJohnson enumerates every cycle of ladderTrap graphs of
+// growing depth. At a limit of every node that owes anything the search
+// blocks the ladder after walking it once from each spoke; one below, it
+// cannot, and walks every one of the ladder's paths from every spoke.
+func BenchmarkFindCyclesJohnson(b *testing.B) {
+    for _, levels := range []int{8, 10, 12} {
+        g, _, err := buildGraph(ladderTrap(levels))
+        if err != nil {
+            b.Fatal(err)
+        }
+        scc := g.FindSCCs()[0]
+        n := len(g.Edges)
+        for _, mode := range []struct {
+            name  string
+            limit int
+        }{{"johnson", n}, {"dfs", n - 1}} {
+            b.Run(fmt.Sprintf("levels=%d/%s", levels, mode.name), func(b *testing.B) {
+                b.ReportAllocs()
+                for i := 0; i < b.N; i++ {
+                    g.FindCycles(scc, mode.limit)
+                }
+            })
+        }
+    }
+}
+
+// BenchmarkNetDenseSCC nets complete graphs searched to their full length,
+// which is too dense to enumerate and so settled on net positions
+func BenchmarkNetDenseSCC(b *testing.B) {
+    for _, n := range []int{12, 24, 48} {
+        intents := complete(n)
+        opts := Options{MaxCycleLength: n, Logger: log.New(io.Discard, "", 0)}
+        b.Run(fmt.Sprintf("K%d", n), func(b *testing.B) {
+            b.ReportAllocs()
+            for i := 0; i < b.N; i++ {
+                if _, err := ProcessNettingWithOptions(intents, opts); err != nil {
+                    b.Fatal(err)
+                }
+            }
+        })
+    }
+}
@@ -0,0 +1,81 @@
+package netting
+
+import (
+    "math/big"
+)
+
+// BigAmount is an arbitrary-precision Amount, for amounts that do not fit
+// in a uint64 such as wei-denominated ERC-20 balances. Its methods return
+// new values and never modify an operand, so amounts may be shared freely.
+// The zero value is zero.
+type BigAmount struct {
+    n *big.Int
+}
+
+// NewBigAmount returns n as a BigAmount. n is copied, so the caller may
+// reuse it afterwards; nil is zero.
+func NewBigAmount(n *big.Int) BigAmount {
+    if n == nil {
+        return BigAmount{}
+    }
+    return BigAmount{n: new(big.Int).Set(n)}
+}
+
+// value returns a's value, which must not be modified
+func (a BigAmount) value() *big.Int {
+    if a.n == nil {
+        return new(big.Int)
+    }
+    return a.n
+}
+
+// Int returns a copy of a's value
+func (a BigAmount) Int() *big.Int {
+    return new(big.Int).Set(a.value())
+}
+
+func (a BigAmount) Add(b BigAmount) (BigAmount, error) {
+    return BigAmount{n: new(big.Int).Add(a.value(), b.value())}, nil
+}
+
+func (a BigAmount) Sub(b BigAmount) (BigAmount, error) {
+    return BigAmount{n: new(big.Int).Sub(a.value(), b.value())}, nil
+}
+
+func (a BigAmount) Min(b BigAmount) BigAmount {
+    if b.value().Cmp(a.value()) < 0 {
+        return b
+    }
+    return a
+}
+
+func (a BigAmount) IsZero() bool {
+    return a.value().Sign() == 0
+}
+
+// Sign returns -1, 0 or 1 as a is negative, zero or positive
+func (a BigAmount) Sign() int {
+    return a.value().Sign()
+}
+
+func (a BigAmount) String() string {
+    return a.value().String()
+}
+
+// IntentBig is an Intent with an arbitrary-precision amount
+type IntentBig = AmountIntent[BigAmount]
+
+// EdgeBig is the arbitrary-precision counterpart of Edge
+type EdgeBig = AmountEdge[BigAmount]
+
+// GraphBig is the debt network with arbitrary-precision amounts
+type GraphBig = AmountGraph[BigAmount]
+
+func NewGraphBig() *GraphBig {
+    return NewAmountGraph[BigAmount]()
+}
+
+// ProcessNettingBig is ProcessNetting for arbitrary-precision amounts
+func ProcessNettingBig(intents []IntentBig) ([]IntentBig, error) {
+    return ProcessNettingAmount(intents)
+}
@@ -0,0 +1,98 @@
+package netting
+
+import (
+    "math/big"
+    "testing"
+)
+
+// bigAmount returns n as a BigAmount
+func bigAmount(n int64) BigAmount {
+    return NewBigAmount(big.NewInt(n))
+}
+
+func TestProcessNettingBig(t *testing.T) {
+    // 10^30 does not fit in a uint64
+    huge, _ := new(big.Int).SetString("1000000000000000000000000000000", 10)
+    more := new(big.Int).Add(huge, big.NewInt(7))
+    out, err := ProcessNettingBig([]IntentBig{
+        {Sender: "A", Receiver: "B", Token: "T", Amount: NewBigAmount(more)},
+        {Sender: "B", Receiver: "C", Token: "T", Amount: NewBigAmount(huge)},
+        {Sender: "C", Receiver: "A", Token: "T", Amount: NewBigAmount(huge)},
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(out) != 1 || out[0].Sender != "A" || out[0].Receiver != "B" || out[0].Amount.Int().Cmp(big.NewInt(7)) != 0 {
+        t.Errorf("ProcessNettingBig = %v, want A -> B 7", out)
+    }
+}
+
+func TestGraphBigApplyNettingRepeatedHop(t *testing.T) {
+    g := NewGraphBig()
+    g.AddEdge("A", "B", "T", bigAmount(10))
+    g.AddEdge("B", "A", "T", bigAmount(10))
+
+    // Each hop is listed twice, so netting 6 needs 12 on each edge
+    if err := g.ApplyNetting([]string{"A", "B", "A", "B"}, "T", bigAmount(6)); err == nil {
+        t.Fatal("ApplyNetting succeeded past zero")
+    }
+    for _, intent := range g.ToIntents() {
+        if intent.Amount.Int().Cmp(big.NewInt(10)) != 0 {
+            t.Errorf("%s -> %s = %v after rejected netting, want 10", intent.Sender, intent.Receiver, intent.Amount)
+        }
+    }
+    if len(g.ToIntents()) != 2 {
+        t.Errorf("edges = %v, want both kept", g.ToIntents())
+    }
+
+    if err := g.ApplyNetting([]string{"A", "B", "A", "B"}, "T", bigAmount(5)); err != nil {
+        t.Fatal(err)
+    }
+    if left := g.ToIntents(); len(left) != 0 {
+        t.Errorf("edges = %v, want none", left)
+    }
+}
+
+func TestGraphBigApplyNettingRejectsNonPositive(t *testing.T) {
+    g := NewGraphBig()
+    if err := g.AddEdge("A", "B", "T", bigAmount(-1)); err == nil {
+        t.Error("AddEdge accepted a negative amount")
+    }
+    g.AddEdge("A", "B", "T", bigAmount(10))
+    g.AddEdge("B", "A", "T", bigAmount(10))
+
+    // Netting a negative amount would add to every edge
+    for _, amount := range []BigAmount{bigAmount(-5), bigAmount(0), NewBigAmount(nil)} {
+        if err := g.ApplyNetting([]string{"A", "B"}, "T", amount); err == nil {
+            t.Errorf("ApplyNetting(%v) succeeded", amount)
+        }
+    }
+    for _, intent := range g.ToIntents() {
+        if intent.Amount.Int().Cmp(big.NewInt(10)) != 0 {
+            t.Errorf("%s -> %s = %v after rejected netting, want 10", intent.Sender, intent.Receiver, intent.Amount)
+        }
+    }
+}
+
+func TestGraphBigApplyNettingAliasedAmount(t *testing.T) {
+    g := NewGraphBig()
+    g.AddEdge("A", "B", "T", bigAmount(4))
+    g.AddEdge("B", "C", "T", bigAmount(9))
+    g.AddEdge("C", "A", "T", bigAmount(7))
+
+    // The amount is A -> B's own; subtracting from it in place would leave
+    // nothing to take off B -> C and C -> A
+    if err := g.ApplyNetting([]string{"A", "B", "C"}, "T", g.Edges["A"][0].Amount); err != nil {
+        t.Fatal(err)
+    }
+    want := map[string]int64{"B->C": 5, "C->A": 3}
+    got := g.ToIntents()
+    if len(got) != len(want) {
+        t.Fatalf("edges = %v, want %v", got, want)
+    }
+    for _, intent := range got {
+        if intent.Amount.Int().Cmp(big.NewInt(want[intent.Sender+"->"+intent.Receiver])) != 0 {
+            t.Errorf("%s -> %s = %v, want %d", intent.Sender, intent.Receiver, intent.Amount, want[intent.Sender+"->"+intent.Receiver])
+        }
+    }
+}
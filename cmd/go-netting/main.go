@@ -0,0 +1,184 @@
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "flag"
+    "fmt"
+    "io"
+    "os"
+    "sort"
+
+    netting "bhaskar1001101/go-netting"
+)
+
+const usage = `usage: go-netting <command> [flags]
+
+commands:
+  net    net a batch of intents read from a file or stdin
+  demo   net a built-in example batch
+`
+
+func main() {
+    if len(os.Args) < 2 {
+        fmt.Fprint(os.Stderr, usage)
+        os.Exit(2)
+    }
+
+    var err error
+    switch os.Args[1] {
+    case "net":
+        err = runNet(os.Args[2:])
+    case "demo":
+        err = runDemo()
+    case "-h", "-help", "--help", "help":
+        fmt.Print(usage)
+        return
+    default:
+        fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+        os.Exit(2)
+    }
+    if errors.Is(err, flag.ErrHelp) {
+        return
+    }
+    if err != nil {
+        fmt.Fprintln(os.Stderr, "go-netting:", err)
+        os.Exit(1)
+    }
+}
+
+// runNet reads intents, nets them and writes the result, in the format
+// chosen by --format for both input and output
+func runNet(args []string) error {
+    fs := flag.NewFlagSet("net", flag.ContinueOnError)
+    input := fs.String("input", "-", "file to read intents from, or - for stdin")
+    output := fs.String("output", "-", "file to write netted intents to, or - for stdout")
+    maxCycle := fs.Int("max-cycle", netting.DefaultMaxCycleLength, "longest cycle, in hops, to net")
+    format := fs.String("format", "json", "intent format, json, jsonl or csv")
+    stats := fs.Bool("stats", false, "print reduction statistics to stderr")
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+    if *format != "json" && *format != "jsonl" && *format != "csv" {
+        return fmt.Errorf("unknown format %q", *format)
+    }
+
+    in := io.Reader(os.Stdin)
+    if *input != "-" {
+        f, err := os.Open(*input)
+        if err != nil {
+            return err
+        }
+        defer f.Close()
+        in = f
+    }
+    intents, err := readIntents(in, *format)
+    if err != nil {
+        return fmt.Errorf("reading intents: %w", err)
+    }
+
+    result, s, err := netting.ProcessNettingWithStatsOptions(intents, netting.Options{MaxCycleLength: *maxCycle})
+    if err != nil {
+        return err
+    }
+
+    out := io.Writer(os.Stdout)
+    if *output != "-" {
+        f, err := os.Create(*output)
+        if err != nil {
+            return err
+        }
+        defer f.Close()
+        out = f
+    }
+    if err := writeIntents(out, result, *format); err != nil {
+        return fmt.Errorf("writing intents: %w", err)
+    }
+
+    if *stats {
+        printStats(os.Stderr, s)
+    }
+    return nil
+}
+
+func readIntents(r io.Reader, format string) ([]netting.Intent, error) {
+    switch format {
+    case "csv":
+        return netting.LoadIntentsCSV(r)
+    case "jsonl":
+        return netting.LoadIntentsJSONL(r)
+    }
+    data, err := io.ReadAll(r)
+    if err != nil {
+        return nil, err
+    }
+    return netting.IntentsFromJSON(data)
+}
+
+func writeIntents(w io.Writer, intents []netting.Intent, format string) error {
+    switch format {
+    case "csv":
+        return netting.WriteIntentsCSV(w, intents)
+    case "jsonl":
+        enc := json.NewEncoder(w)
+        for _, intent := range intents {
+            if err := enc.Encode(intent); err != nil {
+                return err
+            }
+        }
+        return nil
+    }
+    data, err := netting.IntentsToJSON(intents)
+    if err != nil {
+        return err
+    }
+    _, err = fmt.Fprintf(w, "%s\n", data)
+    return err
+}
+
+func printStats(w io.Writer, s netting.Stats) {
+    fmt.Fprintf(w, "intents: %d -> %d (%.1f%% fewer)\n", s.IntentsBefore, s.IntentsAfter, s.CountReduction())
+    if s.SelfLoopsDropped > 0 {
+        fmt.Fprintf(w, "self-loops dropped: %d\n", s.SelfLoopsDropped)
+    }
+
+    tokens := make([]string, 0, len(s.GrossBefore))
+    for token := range s.GrossBefore {
+        tokens = append(tokens, token)
+    }
+    sort.Strings(tokens)
+    for _, token := range tokens {
+        fmt.Fprintf(w, "%s volume: %d -> %d (%.1f%% less)\n",
+            token, s.GrossBefore[token], s.GrossAfter[token], s.VolumeReduction(token))
+    }
+}
+
+func runDemo() error {
+    // Example intents
+    intents := []netting.Intent{
+        {Sender: "A", Receiver: "B", Token: "ETH", Amount: 100},
+        {Sender: "B", Receiver: "C", Token: "ETH", Amount: 50},
+        {Sender: "C", Receiver: "A", Token: "ETH", Amount: 30},
+        {Sender: "D", Receiver: "E", Token: "USDC", Amount: 200},
+        {Sender: "E", Receiver: "D", Token: "USDC", Amount: 200},
+    }
+
+    fmt.Println("Original intents:")
+    for _, intent := range intents {
+        fmt.Printf("%s -> %s: %d %s\n", 
+            intent.Sender, intent.Receiver, intent.Amount, intent.Token)
+    }
+
+    // Process netting
+    remainingIntents, err := netting.ProcessNetting(intents)
+    if err != nil {
+        return fmt.Errorf("netting failed: %w", err)
+    }
+
+    fmt.Println("\nRemaining intents after netting:")
+    for _, intent := range remainingIntents {
+        fmt.Printf("%s -> %s: %d %s\n", 
+            intent.Sender, intent.Receiver, intent.Amount, intent.Token)
+    }
+    return nil
+}
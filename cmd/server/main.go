@@ -0,0 +1,19 @@
+package main
+
+import (
+    "flag"
+    "log"
+    "net/http"
+
+    netting "bhaskar1001101/go-netting"
+)
+
+func main() {
+    addr := flag.String("addr", ":8080", "address to listen on")
+    flag.Parse()
+
+    http.HandleFunc("/net", netting.NettingHandler)
+
+    log.Printf("listening on %s", *addr)
+    log.Fatal(http.ListenAndServe(*addr, nil))
+}
@@ -0,0 +1,94 @@
+package netting
+
+// unionFind is a disjoint-set forest over nodes
+type unionFind[N comparable] struct {
+    parent map[N]N
+}
+
+func newUnionFind[N comparable]() *unionFind[N] {
+    return &unionFind[N]{parent: make(map[N]N)}
+}
+
+// find returns the representative of v's set, adding v if it is new
+func (u *unionFind[N]) find(v N) N {
+    if _, ok := u.parent[v]; !ok {
+        u.parent[v] = v
+        return v
+    }
+    root := v
+    for u.parent[root] != root {
+        root = u.parent[root]
+    }
+    // Compress the path so later lookups are direct
+    for v != root {
+        next := u.parent[v]
+        u.parent[v] = root
+        v = next
+    }
+    return root
+}
+
+// union merges the sets containing a and b
+func (u *unionFind[N]) union(a, b N) {
+    ra, rb := u.find(a), u.find(b)
+    if ra != rb {
+        u.parent[ra] = rb
+    }
+}
+
+// count returns the number of disjoint sets
+func (u *unionFind[N]) count() int {
+    n := 0
+    for v, p := range u.parent {
+        if v == p {
+            n++
+        }
+    }
+    return n
+}
+
+// ComponentsByToken returns, per token, the number of weakly connected
+// components formed by that token's edges alone. Unlike SCCs, edge direction
+// is ignored, so each component is a cluster that settles independently.
+func (g *GraphOf[N]) ComponentsByToken() map[string]int {
+    sets := make(map[string]*unionFind[N])
+    for from, edges := range g.Edges {
+        for _, edge := range edges {
+            if sets[edge.Token] == nil {
+                sets[edge.Token] = newUnionFind[N]()
+            }
+            sets[edge.Token].union(from, edge.To)
+        }
+    }
+
+    counts := make(map[string]int, len(sets))
+    for token, set := range sets {
+        counts[token] = set.count()
+    }
+    return counts
+}
+
+// GroupByComponent partitions intents into groups that share no
+// participants, ignoring direction and token, so each group can be settled
+// as an independent batch. Groups are ordered by their first intent and keep
+// the input order within them.
+func GroupByComponent(intents []Intent) [][]Intent {
+    set := newUnionFind[string]()
+    for _, intent := range intents {
+        set.union(intent.Sender, intent.Receiver)
+    }
+
+    groups := make([][]Intent, 0)
+    index := make(map[string]int)
+    for _, intent := range intents {
+        root := set.find(intent.Sender)
+        i, ok := index[root]
+        if !ok {
+            i = len(groups)
+            index[root] = i
+            groups = append(groups, nil)
+        }
+        groups[i] = append(groups[i], intent)
+    }
+    return groups
+}
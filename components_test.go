@@ -0,0 +1,43 @@
+package netting
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestComponentsByToken(t *testing.T) {
+    g, _, err := buildGraph([]Intent{
+        // Two separate A clusters
+        {Sender: "a1", Receiver: "a2", Token: "A", Amount: 1},
+        {Sender: "a3", Receiver: "a2", Token: "A", Amount: 1},
+        {Sender: "a4", Receiver: "a5", Token: "A", Amount: 1},
+        // One B cluster, joining nodes of both A clusters
+        {Sender: "a1", Receiver: "b1", Token: "B", Amount: 1},
+        {Sender: "b1", Receiver: "a4", Token: "B", Amount: 1},
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    if got, want := g.ComponentsByToken(), map[string]int{"A": 2, "B": 1}; !reflect.DeepEqual(got, want) {
+        t.Errorf("ComponentsByToken = %v, want %v", got, want)
+    }
+}
+
+func TestGroupByComponent(t *testing.T) {
+    intents := []Intent{
+        {Sender: "A", Receiver: "B", Token: "T", Amount: 1},
+        {Sender: "X", Receiver: "Y", Token: "T", Amount: 2},
+        {Sender: "C", Receiver: "B", Token: "U", Amount: 3},
+        {Sender: "Y", Receiver: "Z", Token: "U", Amount: 4},
+    }
+    groups := GroupByComponent(intents)
+    if len(groups) != 2 {
+        t.Fatalf("GroupByComponent = %v, want two groups", groups)
+    }
+    want := [][]Intent{{intents[0], intents[2]}, {intents[1], intents[3]}}
+    for i := range want {
+        if !IntentsEqual(groups[i], want[i]) {
+            t.Errorf("group %d = %v, want %v", i, groups[i], want[i])
+        }
+    }
+}
@@ -0,0 +1,45 @@
+package netting
+
+import (
+    "errors"
+    "fmt"
+    "strings"
+)
+
+// ErrCreditLimit is returned when a debt would exceed the credit limit set
+// for its sender, receiver and token
+var ErrCreditLimit = errors.New("credit limit exceeded")
+
+// checkCredit returns an error wrapping ErrCreditLimit if adding amount to
+// the edge from -> to in token would take it past its limit in limits. An
+// amount that would overflow the edge is left for addEdge to report.
+func (g *GraphOf[N]) checkCredit(limits map[EdgeKeyOf[N]]uint64, from, to N, token string, amount uint64) error {
+    limit, ok := limits[EdgeKeyOf[N]{From: from, To: to, Token: token}]
+    if !ok {
+        return nil
+    }
+    owed, _ := g.GetEdge(from, to, token)
+    if owed <= limit && amount <= limit-owed {
+        return nil
+    }
+    return fmt.Errorf("%v -> %v %s: owing %d more on %d would exceed limit %d: %w", from, to, token, amount, owed, limit, ErrCreditLimit)
+}
+
+// CheckCreditLimits reports every edge of g owing more than its limit in
+// limits, sorted by sender, in an error wrapping ErrCreditLimit. It returns
+// nil if all edges are within their limits.
+func (g *GraphOf[N]) CheckCreditLimits(limits map[EdgeKeyOf[N]]uint64) error {
+    var breaches []string
+    for _, from := range g.sources() {
+        for _, edge := range g.Edges[from] {
+            limit, ok := limits[EdgeKeyOf[N]{From: from, To: edge.To, Token: edge.Token}]
+            if ok && edge.Amount > limit {
+                breaches = append(breaches, fmt.Sprintf("%v -> %v %s: owes %d, limit %d", from, edge.To, edge.Token, edge.Amount, limit))
+            }
+        }
+    }
+    if len(breaches) > 0 {
+        return fmt.Errorf("%w: %s", ErrCreditLimit, strings.Join(breaches, "; "))
+    }
+    return nil
+}
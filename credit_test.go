@@ -0,0 +1,187 @@
+package netting
+
+import (
+    "errors"
+    "fmt"
+    "math/rand"
+    "reflect"
+    "testing"
+)
+
+func TestCreditLimits(t *testing.T) {
+    limits := map[EdgeKey]uint64{
+        {From: "A", To: "B", Token: "T"}: 10,
+        {From: "B", To: "C", Token: "T"}: 6,
+    }
+    e, err := NewNettingEngineWithOptions(Options{CreditLimits: limits})
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, intent := range triangle("T", 6) {
+        if err := e.AddIntent(intent); err != nil {
+            t.Fatal(err)
+        }
+    }
+    before := e.Intents()
+    if err := e.AddIntent(Intent{Sender: "B", Receiver: "C", Token: "T", Amount: 1}); !errors.Is(err, ErrCreditLimit) {
+        t.Fatalf("AddIntent past the limit = %v, want ErrCreditLimit", err)
+    }
+    if got := e.Intents(); !reflect.DeepEqual(got, before) {
+        t.Errorf("intents = %v after a rejected add, want %v", got, before)
+    }
+
+    // Netting frees up the line again
+    e.Settle()
+    if err := e.AddIntent(Intent{Sender: "B", Receiver: "C", Token: "T", Amount: 6}); err != nil {
+        t.Errorf("AddIntent after netting = %v", err)
+    }
+}
+
+func TestCreditLimitsBatch(t *testing.T) {
+    // The triangle nets 4 off each hop, taking A -> B from 10 to 6
+    intents := []Intent{
+        {Sender: "A", Receiver: "B", Token: "T", Amount: 10},
+        {Sender: "B", Receiver: "C", Token: "T", Amount: 7},
+        {Sender: "C", Receiver: "A", Token: "T", Amount: 4},
+    }
+    key := EdgeKey{From: "A", To: "B", Token: "T"}
+
+    // Over its limit of 6 to start with, but not once netted
+    out, err := ProcessNettingWithOptions(intents, Options{CreditLimits: map[EdgeKey]uint64{key: 6}})
+    if err != nil {
+        t.Fatalf("limit 6: %v", err)
+    }
+    want := []Intent{
+        {Sender: "A", Receiver: "B", Token: "T", Amount: 6},
+        {Sender: "B", Receiver: "C", Token: "T", Amount: 3},
+    }
+    if !reflect.DeepEqual(out, want) {
+        t.Errorf("limit 6 left %v, want %v", out, want)
+    }
+
+    // Netting cannot get it down to 5
+    for _, opts := range []Options{
+        {CreditLimits: map[EdgeKey]uint64{key: 5}},
+        {CreditLimits: map[EdgeKey]uint64{key: 5}, Workers: 2},
+        {CreditLimits: map[EdgeKey]uint64{key: 5}, ShortestCycles: true},
+    } {
+        if _, err := ProcessNettingWithOptions(intents, opts); !errors.Is(err, ErrCreditLimit) {
+            t.Errorf("limit 5 with %+v = %v, want ErrCreditLimit", opts, err)
+        }
+    }
+    if _, _, err := ProcessNettingWithOps(intents, Options{CreditLimits: map[EdgeKey]uint64{key: 5}}); !errors.Is(err, ErrCreditLimit) {
+        t.Errorf("ProcessNettingWithOps at limit 5 = %v, want ErrCreditLimit", err)
+    }
+}
+
+func TestOptimalNetSingleTokenWithLimits(t *testing.T) {
+    // The 4-cycle nets 8 on its own and leaves the 3-cycle's 3 on B -> E
+    // and E -> A; a limit of 1 on B -> E means netting 2 of it instead
+    intents := []Intent{
+        {Sender: "A", Receiver: "B", Token: "T", Amount: 8},
+        {Sender: "B", Receiver: "C", Token: "T", Amount: 8},
+        {Sender: "C", Receiver: "D", Token: "T", Amount: 8},
+        {Sender: "D", Receiver: "A", Token: "T", Amount: 8},
+        {Sender: "B", Receiver: "E", Token: "T", Amount: 3},
+        {Sender: "E", Receiver: "A", Token: "T", Amount: 3},
+    }
+    limits := map[EdgeKey]uint64{{From: "B", To: "E", Token: "T"}: 1}
+    out, err := OptimalNetSingleTokenWithLimits(intents, "T", limits)
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := []Intent{
+        {Sender: "B", Receiver: "C", Token: "T", Amount: 2},
+        {Sender: "B", Receiver: "E", Token: "T", Amount: 1},
+        {Sender: "C", Receiver: "D", Token: "T", Amount: 2},
+        {Sender: "D", Receiver: "A", Token: "T", Amount: 2},
+        {Sender: "E", Receiver: "A", Token: "T", Amount: 1},
+    }
+    if !reflect.DeepEqual(out, want) {
+        t.Errorf("limit 1 on B -> E left %v, want %v", out, want)
+    }
+    if err := VerifyConservation(intents, out); err != nil {
+        t.Error(err)
+    }
+
+    // B -> C is only on the 4-cycle, which can net all of it, but clearing
+    // D -> A and E -> A would take 11 off A -> B, which holds 8
+    limits = map[EdgeKey]uint64{{From: "B", To: "C", Token: "T"}: 0}
+    if _, err := OptimalNetSingleTokenWithLimits(intents, "T", limits); err != nil {
+        t.Errorf("limit 0 on B -> C: %v", err)
+    }
+    limits = map[EdgeKey]uint64{{From: "E", To: "A", Token: "T"}: 0, {From: "D", To: "A", Token: "T"}: 0}
+    if _, err := OptimalNetSingleTokenWithLimits(intents, "T", limits); !errors.Is(err, ErrCreditLimit) {
+        t.Errorf("limit 0 on D -> A and E -> A = %v, want ErrCreditLimit", err)
+    }
+
+    // A credit line from A to C lets A's debt through B be routed to C
+    // directly, but no further than the line allows
+    chain := []Intent{
+        {Sender: "A", Receiver: "B", Token: "T", Amount: 10},
+        {Sender: "B", Receiver: "C", Token: "T", Amount: 10},
+    }
+    for _, tc := range []struct {
+        limit uint64
+        want  []Intent
+    }{
+        {4, []Intent{
+            {Sender: "A", Receiver: "B", Token: "T", Amount: 6},
+            {Sender: "A", Receiver: "C", Token: "T", Amount: 4},
+            {Sender: "B", Receiver: "C", Token: "T", Amount: 6},
+        }},
+        {25, []Intent{{Sender: "A", Receiver: "C", Token: "T", Amount: 10}}},
+    } {
+        limits := map[EdgeKey]uint64{{From: "A", To: "C", Token: "T"}: tc.limit}
+        out, err := OptimalNetSingleTokenWithLimits(chain, "T", limits)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if !reflect.DeepEqual(out, tc.want) {
+            t.Errorf("A -> C limit %d left %v, want %v", tc.limit, out, tc.want)
+        }
+        if err := VerifyConservation(chain, out); err != nil {
+            t.Error(err)
+        }
+    }
+    if out, err := OptimalNetSingleToken(chain, "T"); err != nil || !reflect.DeepEqual(out, chain) {
+        t.Errorf("without limits the chain became %v, %v", out, err)
+    }
+
+    // Random limits, some below what is owed and some on pairs owing
+    // nothing, are kept whenever netting succeeds
+    r := rand.New(rand.NewSource(8))
+    for trial := 0; trial < 30; trial++ {
+        intents := randomIntents(r, 6, 1, 20)
+        limits := make(map[EdgeKey]uint64)
+        for i := 0; i < 8; i++ {
+            from, to := r.Intn(6), r.Intn(6)
+            limits[EdgeKey{From: fmt.Sprintf("n%d", from), To: fmt.Sprintf("n%d", to), Token: "t0"}] = uint64(r.Intn(150))
+        }
+        out, err := OptimalNetSingleTokenWithLimits(intents, "t0", limits)
+        if errors.Is(err, ErrCreditLimit) {
+            continue
+        }
+        if err != nil {
+            t.Fatal(err)
+        }
+        if err := VerifyConservation(intents, out); err != nil {
+            t.Errorf("trial %d: %v", trial, err)
+        }
+        g, _, err := buildGraph(out)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if err := g.CheckCreditLimits(limits); err != nil {
+            t.Errorf("trial %d: %v", trial, err)
+        }
+        before, _, _ := buildGraph(intents)
+        for _, intent := range out {
+            _, owed := before.GetEdge(intent.Sender, intent.Receiver, intent.Token)
+            _, limited := limits[EdgeKey{From: intent.Sender, To: intent.Receiver, Token: intent.Token}]
+            if !owed && !limited {
+                t.Errorf("trial %d: new debt %v without a credit line", trial, intent)
+            }
+        }
+    }
+}
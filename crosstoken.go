@@ -0,0 +1,151 @@
+package netting
+
+import (
+    "fmt"
+    "math/big"
+    "sort"
+)
+
+// hopValue returns the value, in the common unit, of everything owed
+// from -> to across all tokens
+func (g *GraphOf[N]) hopValue(from, to N, rates map[string]*big.Rat) *big.Rat {
+    value := new(big.Rat)
+    for _, edge := range g.Edges[from] {
+        if edge.To == to {
+            amount := new(big.Rat).SetInt(new(big.Int).SetUint64(edge.Amount))
+            value.Add(value, amount.Mul(amount, rates[edge.Token]))
+        }
+    }
+    return value
+}
+
+// reduceHop lowers the edges from -> to by up to value in the common unit,
+// consuming tokens in sorted order. Each token amount is rounded down, so the
+// hop is never reduced by more than value.
+func (g *GraphOf[N]) reduceHop(from, to N, value *big.Rat, rates map[string]*big.Rat) {
+    tokens := make([]string, 0)
+    for _, edge := range g.Edges[from] {
+        if edge.To == to {
+            tokens = append(tokens, edge.Token)
+        }
+    }
+    sort.Strings(tokens)
+
+    remaining := new(big.Rat).Set(value)
+    for _, token := range tokens {
+        if remaining.Sign() <= 0 {
+            break
+        }
+        amount, _ := g.GetEdge(from, to, token)
+
+        // The most of this token the remaining value pays for
+        units := new(big.Rat).Quo(remaining, rates[token])
+        take := new(big.Int).Quo(units.Num(), units.Denom())
+        if take.Cmp(new(big.Int).SetUint64(amount)) > 0 {
+            take.SetUint64(amount)
+        }
+        if take.Sign() == 0 {
+            continue
+        }
+
+        g.subtract(from, to, token, take.Uint64())
+        spent := new(big.Rat).SetInt(take)
+        remaining.Sub(remaining, spent.Mul(spent, rates[token]))
+    }
+}
+
+// ProcessNettingCrossToken nets cycles whose hops may be denominated in
+// different tokens. rates gives the value of one unit of each token in a
+// common numeraire and must have a positive entry for every token in
+// intents.
+//
+// For each cycle the nettable value is the smallest total value owed on any
+// hop. Every hop is then reduced by that value, converting back to token
+// units by rounding down and consuming the hop's tokens in sorted order. A
+// hop is therefore never reduced by more than the nettable value, and each
+// participant's position in the common unit is preserved to within one unit
+// of the most valuable token on its edges.
+func ProcessNettingCrossToken(intents []Intent, rates map[string]*big.Rat) ([]Intent, error) {
+    g, _, err := netCrossToken(intents, rates)
+    if err != nil {
+        return nil, err
+    }
+    return g.ToIntents(), nil
+}
+
+// ProcessNettingCrossTokenWithDust is ProcessNettingCrossToken that also
+// writes off rounding dust. Any edge that netting reduced and whose value in
+// the common unit is now below dustThreshold is dropped; such residuals are
+// left by rounding to token units and would only form spurious micro-cycles
+// later. The units written off are returned per token. Edges netting did not
+// touch are kept however small.
+func ProcessNettingCrossTokenWithDust(intents []Intent, rates map[string]*big.Rat, dustThreshold *big.Rat) ([]Intent, map[string]uint64, error) {
+    if dustThreshold == nil || dustThreshold.Sign() < 0 {
+        return nil, nil, fmt.Errorf("dust threshold must be non-negative")
+    }
+    g, before, err := netCrossToken(intents, rates)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    // Collect first, as removing edges shifts the slices being ranged over
+    var dust []EdgeKey
+    for _, from := range g.sources() {
+        for _, edge := range g.Edges[from] {
+            original, _ := before.GetEdge(from, edge.To, edge.Token)
+            if edge.Amount >= original {
+                continue
+            }
+            value := new(big.Rat).SetInt(new(big.Int).SetUint64(edge.Amount))
+            if value.Mul(value, rates[edge.Token]).Cmp(dustThreshold) < 0 {
+                dust = append(dust, EdgeKey{From: from, To: edge.To, Token: edge.Token})
+            }
+        }
+    }
+
+    written := make(map[string]uint64)
+    for _, key := range dust {
+        amount, _ := g.GetEdge(key.From, key.To, key.Token)
+        g.RemoveEdge(key.From, key.To, key.Token)
+        // Bounded by the token's gross volume, which fits a uint64
+        written[key.Token] += amount
+    }
+    return g.ToIntents(), written, nil
+}
+
+// netCrossToken builds the graph for intents and nets it across tokens,
+// returning it along with a copy of the graph before netting
+func netCrossToken(intents []Intent, rates map[string]*big.Rat) (*Graph, *Graph, error) {
+    g, _, err := buildGraph(intents)
+    if err != nil {
+        return nil, nil, err
+    }
+    for i, intent := range intents {
+        if rate := rates[intent.Token]; rate == nil || rate.Sign() <= 0 {
+            return nil, nil, fmt.Errorf("intent %d: no positive rate for token %q", i, intent.Token)
+        }
+    }
+    before := g.Clone()
+
+    for _, scc := range g.FindSCCs() {
+        for _, cycle := range g.FindCycles(scc, DefaultMaxCycleLength) {
+            // Nettable value is the smallest hop value around the cycle
+            var value *big.Rat
+            for i := 0; i < len(cycle); i++ {
+                hop := g.hopValue(cycle[i], cycle[(i+1)%len(cycle)], rates)
+                if value == nil || hop.Cmp(value) < 0 {
+                    value = hop
+                }
+            }
+            if value == nil || value.Sign() == 0 {
+                continue
+            }
+
+            for i := 0; i < len(cycle); i++ {
+                g.reduceHop(cycle[i], cycle[(i+1)%len(cycle)], value, rates)
+            }
+        }
+    }
+
+    return g, before, nil
+}
@@ -0,0 +1,43 @@
+package netting
+
+import (
+    "math/big"
+    "reflect"
+    "testing"
+)
+
+func TestCrossTokenDust(t *testing.T) {
+    // The cycle nets 10 units of value. B -> C owes 12 in Y at 3 each, and
+    // rounding down to 3 Y leaves 1 Y, worth 3, behind.
+    intents := []Intent{
+        {Sender: "A", Receiver: "B", Token: "X", Amount: 10},
+        {Sender: "B", Receiver: "C", Token: "Y", Amount: 4},
+        {Sender: "C", Receiver: "A", Token: "X", Amount: 10},
+        {Sender: "D", Receiver: "E", Token: "X", Amount: 1},
+    }
+    rates := map[string]*big.Rat{"X": big.NewRat(1, 1), "Y": big.NewRat(3, 1)}
+
+    out, err := ProcessNettingCrossToken(intents, rates)
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := []Intent{
+        {Sender: "B", Receiver: "C", Token: "Y", Amount: 1},
+        {Sender: "D", Receiver: "E", Token: "X", Amount: 1},
+    }
+    if !reflect.DeepEqual(out, want) {
+        t.Fatalf("ProcessNettingCrossToken = %v, want %v", out, want)
+    }
+
+    // D -> E is below the threshold too, but netting never touched it
+    out, dust, err := ProcessNettingCrossTokenWithDust(intents, rates, big.NewRat(4, 1))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if want := want[1:]; !reflect.DeepEqual(out, want) {
+        t.Errorf("ProcessNettingCrossTokenWithDust = %v, want %v", out, want)
+    }
+    if want := map[string]uint64{"Y": 1}; !reflect.DeepEqual(dust, want) {
+        t.Errorf("dust = %v, want %v", dust, want)
+    }
+}
@@ -0,0 +1,85 @@
+package netting
+
+import (
+    "encoding/csv"
+    "errors"
+    "fmt"
+    "io"
+    "strconv"
+    "strings"
+)
+
+// csvHeader is the column layout read and written by the CSV helpers
+var csvHeader = []string{"sender", "receiver", "token", "amount"}
+
+// LoadIntentsCSV reads intents from CSV with a sender,receiver,token,amount
+// header. Blank lines are skipped, and errors for malformed rows carry their
+// line number.
+func LoadIntentsCSV(r io.Reader) ([]Intent, error) {
+    cr := csv.NewReader(r)
+    cr.FieldsPerRecord = -1
+
+    header, err := cr.Read()
+    if errors.Is(err, io.EOF) {
+        return nil, errors.New("missing CSV header")
+    }
+    if err != nil {
+        return nil, err
+    }
+    if len(header) != len(csvHeader) {
+        return nil, fmt.Errorf("line 1: header has %d columns, want %s", len(header), strings.Join(csvHeader, ","))
+    }
+    for i, name := range header {
+        if !strings.EqualFold(strings.TrimSpace(name), csvHeader[i]) {
+            return nil, fmt.Errorf("line 1: column %d is %q, want %q", i+1, name, csvHeader[i])
+        }
+    }
+
+    intents := make([]Intent, 0)
+    for {
+        record, err := cr.Read()
+        if errors.Is(err, io.EOF) {
+            break
+        }
+        if err != nil {
+            return nil, err
+        }
+        line, _ := cr.FieldPos(0)
+
+        if len(record) != len(csvHeader) {
+            return nil, fmt.Errorf("line %d: got %d fields, want %d", line, len(record), len(csvHeader))
+        }
+        amount, err := strconv.ParseUint(strings.TrimSpace(record[3]), 10, 64)
+        if err != nil {
+            return nil, fmt.Errorf("line %d: invalid amount %q", line, record[3])
+        }
+        intents = append(intents, Intent{
+            Sender:    strings.TrimSpace(record[0]),
+            Receiver:  strings.TrimSpace(record[1]),
+            Token:     strings.TrimSpace(record[2]),
+            Amount:    amount,
+        })
+    }
+    return intents, nil
+}
+
+// WriteIntentsCSV writes intents as CSV in the format read by LoadIntentsCSV
+func WriteIntentsCSV(w io.Writer, intents []Intent) error {
+    cw := csv.NewWriter(w)
+    if err := cw.Write(csvHeader); err != nil {
+        return err
+    }
+    for _, intent := range intents {
+        record := []string{
+            intent.Sender,
+            intent.Receiver,
+            intent.Token,
+            strconv.FormatUint(intent.Amount, 10),
+        }
+        if err := cw.Write(record); err != nil {
+            return err
+        }
+    }
+    cw.Flush()
+    return cw.Error()
+}
@@ -0,0 +1,163 @@
+package netting
+
+import (
+    "context"
+    "log"
+    "sort"
+)
+
+// denseSearchLimit is the expected number of paths a cycle search of an SCC
+// may have to walk beyond which the SCC is settled on net positions instead
+const denseSearchLimit = 1 << 20
+
+// tooDense reports whether searching scc for cycles of up to maxLength nodes
+// is expected to walk more than denseSearchLimit paths. A random digraph on
+// n nodes joining each ordered pair with probability p, taken from scc, has
+// on average n!/(n-k)! * p^(k-1) paths of k nodes.
+func (g *GraphOf[N]) tooDense(scc []N, maxLength int) bool {
+    n := len(scc)
+    members := make(map[N]bool, n)
+    for _, v := range scc {
+        members[v] = true
+    }
+    pairs := 0
+    for _, v := range scc {
+        joined := make(map[N]bool)
+        for _, edge := range g.Edges[v] {
+            if members[edge.To] && !joined[edge.To] {
+                joined[edge.To] = true
+                pairs++
+            }
+        }
+    }
+    p := float64(pairs) / float64(n*(n-1))
+
+    paths, expected := float64(n), 0.0
+    for k := 2; k <= min(maxLength, n); k++ {
+        paths *= float64(n-k+1) * p
+        expected += paths
+        if expected > denseSearchLimit {
+            return true
+        }
+    }
+    return false
+}
+
+// warnDense reports that scc is settled without enumerating its cycles, to
+// the Logger or, if none is set, the standard logger
+func (o OptionsOf[N]) warnDense(scc []N) {
+    var warn Logger = log.Default()
+    if o.Logger != nil {
+        warn = o.Logger
+    }
+    warn.Printf("netting: warning: SCC %v too dense to enumerate, settling it on net positions", scc)
+}
+
+// netDense nets scc without enumerating its cycles. For each token, the
+// debts within scc are netted by the least-volume circulation
+// OptimalNetSingleToken finds, which keeps every net position, and the
+// circulation is applied as the cycles it splits into. Cycles over
+// MaxCycleLength or MaxParticipants, through a forbidden pair, netting less
+// than MinNetAmount or below a MinRetain floor are left out of it.
+func (g *GraphOf[N]) netDense(ctx context.Context, opts OptionsOf[N], scc []N) ([]NettingOpOf[N], error) {
+    members := make(map[N]bool, len(scc))
+    for _, v := range scc {
+        members[v] = true
+    }
+    seen := make(map[string]bool)
+    tokens := make([]string, 0)
+    for _, from := range scc {
+        for _, edge := range g.Edges[from] {
+            if members[edge.To] && !seen[edge.Token] && opts.nets(edge.Token) {
+                seen[edge.Token] = true
+                tokens = append(tokens, edge.Token)
+            }
+        }
+    }
+    sort.Strings(tokens)
+
+    maxLength := opts.MaxCycleLength
+    if opts.MaxParticipants > 0 && opts.MaxParticipants < maxLength {
+        maxLength = opts.MaxParticipants
+    }
+
+    ops := make([]NettingOpOf[N], 0)
+    for _, token := range tokens {
+        if err := ctx.Err(); err != nil {
+            return ops, err
+        }
+        spare := func(from, to N, owed uint64) uint64 {
+            floor := opts.MinRetain[EdgeKeyOf[N]{From: from, To: to, Token: token}]
+            if opts.forbidden[[2]N{from, to}] || owed <= floor || owed-floor < opts.MinNetAmount {
+                return 0
+            }
+            return owed - floor
+        }
+        pairs, err := g.circulate(token, members, spare, nil)
+        if err != nil {
+            return ops, err
+        }
+
+        // Split the circulation into cycles: flow into a node always
+        // leaves it again, so a walk along the flow closes a cycle
+        type hop struct {
+            to   N
+            flow uint64
+        }
+        out := make(map[N][]*hop)
+        starts := make([]N, 0)
+        for _, p := range pairs {
+            if p.netted > 0 {
+                if out[p.from] == nil {
+                    starts = append(starts, p.from)
+                }
+                out[p.from] = append(out[p.from], &hop{to: p.to, flow: p.netted})
+            }
+        }
+        next := func(v N) *hop {
+            for _, h := range out[v] {
+                if h.flow > 0 {
+                    return h
+                }
+            }
+            return nil
+        }
+        for _, start := range starts {
+            for next(start) != nil {
+                path, hops := []N{start}, []*hop{}
+                at := map[N]int{start: 0}
+                for {
+                    h := next(path[len(path)-1])
+                    hops = append(hops, h)
+                    if i, ok := at[h.to]; ok {
+                        path, hops = path[i:], hops[i:]
+                        break
+                    }
+                    at[h.to] = len(path)
+                    path = append(path, h.to)
+                }
+                amount := hops[0].flow
+                for _, h := range hops {
+                    amount = min(amount, h.flow)
+                }
+                for _, h := range hops {
+                    h.flow -= amount
+                }
+
+                if len(path) > maxLength || !opts.worth(amount) {
+                    continue
+                }
+                if opts.OnCycleFound != nil {
+                    opts.OnCycleFound(append([]N(nil), path...))
+                }
+                if err := g.ApplyNetting(path, token, amount); err != nil {
+                    return ops, err
+                }
+                op := NettingOpOf[N]{Cycle: g.canonicalCycle(path), Token: token, Amount: amount}
+                opts.applied(op)
+                ops = append(ops, op)
+            }
+        }
+    }
+    return ops, nil
+}
@@ -0,0 +1,140 @@
+package netting
+
+import (
+    "bytes"
+    "context"
+    "log"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestCompleteGraphs(t *testing.T) {
+    for _, n := range []int{6, 9, 12} {
+        intents := complete(n)
+        for _, maxLength := range []int{0, n} {
+            var buf bytes.Buffer
+            start := time.Now()
+            out, err := ProcessNettingWithOptions(intents, Options{MaxCycleLength: maxLength, Logger: log.New(&buf, "", 0)})
+            if err != nil {
+                t.Fatal(err)
+            }
+            if elapsed := time.Since(start); elapsed > 5*time.Second {
+                t.Errorf("K%d at length %d took %v", n, maxLength, elapsed)
+            }
+            if err := VerifyConservation(intents, out); err != nil {
+                t.Errorf("K%d at length %d: %v", n, maxLength, err)
+            }
+            if len(out) >= len(intents) {
+                t.Errorf("K%d at length %d left %d of %d debts", n, maxLength, len(out), len(intents))
+            }
+
+            // Only K12 searched to its full length is too dense
+            dense := n == 12 && maxLength == 12
+            if warned := strings.Contains(buf.String(), "too dense"); warned != dense {
+                t.Errorf("K%d at length %d: warned %v, want %v", n, maxLength, warned, dense)
+            }
+            if dense && len(mustGraph(t, out).AllCycles(n)) > 0 {
+                t.Errorf("K12 settled on net positions left cycles in %v", out)
+            }
+        }
+    }
+}
+
+// mustGraph returns intents as a graph
+func mustGraph(t *testing.T, intents []Intent) *Graph {
+    t.Helper()
+    g, _, err := buildGraph(intents)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return g
+}
+
+func TestNetDenseK6(t *testing.T) {
+    // Netted bilaterally, as SCCs are before they are searched, K6 is
+    // still one SCC
+    intents := complete(6)
+    g := mustGraph(t, intents)
+    g.netBilateral(Options{})
+    sccs := g.FindSCCs()
+    if len(sccs) != 1 {
+        t.Fatalf("FindSCCs = %v, want one SCC", sccs)
+    }
+
+    start := time.Now()
+    ops, err := g.netDense(context.Background(), Options{MaxCycleLength: 6}, sccs[0])
+    if err != nil {
+        t.Fatal(err)
+    }
+    if elapsed := time.Since(start); elapsed > time.Second {
+        t.Errorf("netDense took %v", elapsed)
+    }
+    out := g.ToIntents()
+    if err := VerifyConservation(intents, out); err != nil {
+        t.Error(err)
+    }
+    if len(ops) == 0 {
+        t.Error("netDense netted nothing")
+    }
+    if cycles := g.AllCycles(6); len(cycles) > 0 {
+        t.Errorf("cycles %v left after netDense", cycles)
+    }
+
+    // The least volume left is what enumerating every cycle may still miss
+    enumerated, err := ProcessNettingWithOptions(intents, Options{MaxCycleLength: 6})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if volume(out) > volume(enumerated) {
+        t.Errorf("netDense left %d, enumeration %d", volume(out), volume(enumerated))
+    }
+
+    // Steps respect the length and participant caps
+    g = mustGraph(t, intents)
+    g.netBilateral(Options{})
+    ops, err = g.netDense(context.Background(), Options{MaxCycleLength: 6, MaxParticipants: 3}, sccs[0])
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, op := range ops {
+        if len(op.Cycle) > 3 {
+            t.Errorf("step %v over 3 participants", op)
+        }
+    }
+    if err := VerifyConservation(intents, g.ToIntents()); err != nil {
+        t.Error(err)
+    }
+}
+
+func TestDenseWarningWithoutLogger(t *testing.T) {
+    var buf bytes.Buffer
+    w, flags := log.Writer(), log.Flags()
+    defer log.SetOutput(w)
+    defer log.SetFlags(flags)
+    log.SetOutput(&buf)
+    log.SetFlags(0)
+
+    if _, err := ProcessNettingWithOptions(complete(12), Options{MaxCycleLength: 12}); err != nil {
+        t.Fatal(err)
+    }
+    if !strings.Contains(buf.String(), "too dense") {
+        t.Errorf("standard log = %q, want the dense SCC warning", buf.String())
+    }
+}
+
+func TestTooDense(t *testing.T) {
+    // Netted bilaterally, as SCCs are before they are searched
+    g := mustGraph(t, complete(12))
+    g.netBilateral(Options{})
+    sccs := g.FindSCCs()
+    if len(sccs) != 1 {
+        t.Fatalf("FindSCCs = %v, want one SCC", sccs)
+    }
+    if g.tooDense(sccs[0], DefaultMaxCycleLength) {
+        t.Error("K12 too dense at the default length")
+    }
+    if !g.tooDense(sccs[0], 12) {
+        t.Error("K12 not too dense at length 12")
+    }
+}
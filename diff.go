@@ -0,0 +1,86 @@
+package netting
+
+import (
+    "math"
+    "sort"
+)
+
+// IntentDelta describes how the total owed from Sender to Receiver in Token
+// changed between two sets of intents
+type IntentDelta struct {
+    Sender   string `json:"sender"`
+    Receiver string `json:"receiver"`
+    Token    string `json:"token"`
+    Before   uint64 `json:"before"`
+    After    uint64 `json:"after"`
+}
+
+// DiffIntents compares intents before and after netting. Intents for the
+// same sender, receiver and token are summed first, less any reversals, and
+// self-loops are ignored, as they are when netting. Debts that netted away
+// entirely are in removed, those netted in part in reduced and those left as
+// they were in unchanged. Cycle netting never raises a debt, but settling
+// on net positions can, so debts that grew, including those only in after
+// with a Before of zero, are in increased. Each list is sorted by sender,
+// receiver and token.
+func DiffIntents(before, after []Intent) (removed, reduced, unchanged, increased []IntentDelta) {
+    deltas := make(map[EdgeKey]*IntentDelta)
+    add := func(intents []Intent, after bool) {
+        for _, intent := range intents {
+            if intent.Sender == intent.Receiver {
+                continue
+            }
+            key := EdgeKey{From: intent.Sender, To: intent.Receiver, Token: intent.Token}
+            d := deltas[key]
+            if d == nil {
+                d = &IntentDelta{Sender: intent.Sender, Receiver: intent.Receiver, Token: intent.Token}
+                deltas[key] = d
+            }
+            total := &d.Before
+            if after {
+                total = &d.After
+            }
+            // Saturate rather than wrap; such a sum could never be netted
+            switch {
+            case intent.Reverse:
+                *total -= min(*total, intent.Amount)
+            case *total > math.MaxUint64-intent.Amount:
+                *total = math.MaxUint64
+            default:
+                *total += intent.Amount
+            }
+        }
+    }
+    add(before, false)
+    add(after, true)
+
+    keys := make([]EdgeKey, 0, len(deltas))
+    for key := range deltas {
+        keys = append(keys, key)
+    }
+    sort.Slice(keys, func(i, j int) bool {
+        a, b := keys[i], keys[j]
+        if a.From != b.From {
+            return a.From < b.From
+        }
+        if a.To != b.To {
+            return a.To < b.To
+        }
+        return a.Token < b.Token
+    })
+
+    for _, key := range keys {
+        d := *deltas[key]
+        switch {
+        case d.After == d.Before:
+            unchanged = append(unchanged, d)
+        case d.After > d.Before:
+            increased = append(increased, d)
+        case d.After == 0:
+            removed = append(removed, d)
+        default:
+            reduced = append(reduced, d)
+        }
+    }
+    return removed, reduced, unchanged, increased
+}
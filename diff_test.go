@@ -0,0 +1,84 @@
+package netting
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestDiffIntents(t *testing.T) {
+    // The triangle nets away its smallest hop, C -> A, and leaves the others
+    // reduced; D -> E is on no cycle
+    before := []Intent{
+        {Sender: "A", Receiver: "B", Token: "T", Amount: 10},
+        {Sender: "B", Receiver: "C", Token: "T", Amount: 7},
+        {Sender: "C", Receiver: "A", Token: "T", Amount: 4},
+        {Sender: "D", Receiver: "E", Token: "T", Amount: 3},
+    }
+    after, err := ProcessNetting(before)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    removed, reduced, unchanged, increased := DiffIntents(before, after)
+    wantRemoved := []IntentDelta{{Sender: "C", Receiver: "A", Token: "T", Before: 4, After: 0}}
+    wantReduced := []IntentDelta{
+        {Sender: "A", Receiver: "B", Token: "T", Before: 10, After: 6},
+        {Sender: "B", Receiver: "C", Token: "T", Before: 7, After: 3},
+    }
+    wantUnchanged := []IntentDelta{{Sender: "D", Receiver: "E", Token: "T", Before: 3, After: 3}}
+    if !reflect.DeepEqual(removed, wantRemoved) {
+        t.Errorf("removed = %v, want %v", removed, wantRemoved)
+    }
+    if !reflect.DeepEqual(reduced, wantReduced) {
+        t.Errorf("reduced = %v, want %v", reduced, wantReduced)
+    }
+    if !reflect.DeepEqual(unchanged, wantUnchanged) {
+        t.Errorf("unchanged = %v, want %v", unchanged, wantUnchanged)
+    }
+    if increased != nil {
+        t.Errorf("increased = %v, want none", increased)
+    }
+
+    // Settling on net positions routes A's debt straight to C, growing
+    // A -> C from 1 to 11, and cancels the mutual U debts of E and F in part
+    before = []Intent{
+        {Sender: "A", Receiver: "B", Token: "T", Amount: 10},
+        {Sender: "B", Receiver: "C", Token: "T", Amount: 10},
+        {Sender: "A", Receiver: "C", Token: "T", Amount: 1},
+        {Sender: "D", Receiver: "E", Token: "T", Amount: 2},
+        {Sender: "E", Receiver: "F", Token: "U", Amount: 3},
+        {Sender: "F", Receiver: "E", Token: "U", Amount: 8},
+    }
+    after, err = MinimizeTransactions(before)
+    if err != nil {
+        t.Fatal(err)
+    }
+    removed, reduced, unchanged, increased = DiffIntents(before, after)
+    wantRemoved = []IntentDelta{
+        {Sender: "A", Receiver: "B", Token: "T", Before: 10, After: 0},
+        {Sender: "B", Receiver: "C", Token: "T", Before: 10, After: 0},
+        {Sender: "E", Receiver: "F", Token: "U", Before: 3, After: 0},
+    }
+    wantReduced = []IntentDelta{{Sender: "F", Receiver: "E", Token: "U", Before: 8, After: 5}}
+    wantUnchanged = []IntentDelta{{Sender: "D", Receiver: "E", Token: "T", Before: 2, After: 2}}
+    wantIncreased := []IntentDelta{{Sender: "A", Receiver: "C", Token: "T", Before: 1, After: 11}}
+    if !reflect.DeepEqual(removed, wantRemoved) {
+        t.Errorf("settled removed = %v, want %v", removed, wantRemoved)
+    }
+    if !reflect.DeepEqual(reduced, wantReduced) {
+        t.Errorf("settled reduced = %v, want %v", reduced, wantReduced)
+    }
+    if !reflect.DeepEqual(unchanged, wantUnchanged) {
+        t.Errorf("settled unchanged = %v, want %v", unchanged, wantUnchanged)
+    }
+    if !reflect.DeepEqual(increased, wantIncreased) {
+        t.Errorf("settled increased = %v, want %v", increased, wantIncreased)
+    }
+
+    // A debt only in after is an increase from zero
+    _, _, _, increased = DiffIntents(nil, []Intent{{Sender: "D", Receiver: "E", Token: "T", Amount: 5}})
+    want := []IntentDelta{{Sender: "D", Receiver: "E", Token: "T", Before: 0, After: 5}}
+    if !reflect.DeepEqual(increased, want) {
+        t.Errorf("added increased = %v, want %v", increased, want)
+    }
+}
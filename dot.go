@@ -0,0 +1,49 @@
+package netting
+
+import (
+    "fmt"
+    "io"
+    "sort"
+    "strings"
+)
+
+// dotColors is the palette edges are colored from, one color per token
+var dotColors = []string{
+    "black", "blue", "red", "darkgreen", "orange",
+    "purple", "brown", "deeppink", "teal", "gold",
+}
+
+// ToDOT writes g as a Graphviz digraph. Each edge is labeled with its amount
+// and token, and edges of the same token share a color.
+func (g *GraphOf[N]) ToDOT(w io.Writer) error {
+    // Assign colors in token order so output is stable
+    tokenSet := make(map[string]bool)
+    for _, edges := range g.Edges {
+        for _, edge := range edges {
+            tokenSet[edge.Token] = true
+        }
+    }
+    tokens := make([]string, 0, len(tokenSet))
+    for token := range tokenSet {
+        tokens = append(tokens, token)
+    }
+    sort.Strings(tokens)
+    colors := make(map[string]string)
+    for i, token := range tokens {
+        colors[token] = dotColors[i%len(dotColors)]
+    }
+
+    var b strings.Builder
+    b.WriteString("digraph debts {\n")
+    for _, from := range g.sources() {
+        for _, edge := range g.Edges[from] {
+            fmt.Fprintf(&b, "    %q -> %q [label=%q, color=%q, fontcolor=%q];\n",
+                fmt.Sprint(from), fmt.Sprint(edge.To), fmt.Sprintf("%d %s", edge.Amount, edge.Token),
+                colors[edge.Token], colors[edge.Token])
+        }
+    }
+    b.WriteString("}\n")
+
+    _, err := io.WriteString(w, b.String())
+    return err
+}
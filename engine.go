@@ -0,0 +1,112 @@
+package netting
+
+import (
+    "context"
+    "sync"
+)
+
+// NettingEngine accumulates intents as they arrive and nets them on demand,
+// keeping the graph between calls instead of rebuilding it for every batch.
+// It is safe for concurrent use.
+//
+// After a settlement that considered every cycle, the engine remembers which
+// participants have had debts added since, and the next Settle searches only
+// the SCCs containing one of them. The rest of the graph cannot have gained a
+// cycle, so a large, mostly static graph is not searched again on every call.
+type NettingEngine struct {
+    mu    sync.RWMutex
+    graph *Graph
+    opts  Options
+
+    // touched holds the senders of intents added since the last complete
+    // settlement. It is nil until one has happened, so the first Settle
+    // searches the whole graph.
+    touched map[string]bool
+}
+
+// NewNettingEngine returns an empty engine using the default Options
+func NewNettingEngine() *NettingEngine {
+    e, _ := NewNettingEngineWithOptions(Options{})
+    return e
+}
+
+// NewNettingEngineWithOptions returns an empty engine that nets with opts
+func NewNettingEngineWithOptions(opts Options) (*NettingEngine, error) {
+    opts, err := opts.withDefaults()
+    if err != nil {
+        return nil, err
+    }
+    return &NettingEngine{graph: NewGraph(), opts: opts}, nil
+}
+
+// AddIntent validates intent and adds it to the engine's graph. An invalid
+// intent, or one whose amount would overflow its edge or take it past its
+// Options.CreditLimits entry, leaves the graph unchanged. A reversal cancels
+// debt still outstanding on its edge and fails if there is not enough.
+func (e *NettingEngine) AddIntent(intent Intent) error {
+    if err := validateIntent(intent); err != nil {
+        return err
+    }
+
+    e.mu.Lock()
+    defer e.mu.Unlock()
+    if !intent.Reverse {
+        if err := e.graph.checkCredit(e.opts.CreditLimits, intent.Sender, intent.Receiver, intent.Token, intent.Amount); err != nil {
+            return err
+        }
+    }
+    if err := e.graph.addIntent(intent); err != nil {
+        return err
+    }
+    if e.touched != nil {
+        e.touched[intent.Sender] = true
+    }
+    return nil
+}
+
+// Settle nets the current graph in place and returns the remaining intents.
+// Intents added concurrently land either wholly before or wholly after the
+// settlement. Calling it again without adding intents returns the same
+// result.
+func (e *NettingEngine) Settle() []Intent {
+    e.mu.Lock()
+    defer e.mu.Unlock()
+    opts := e.opts
+    opts.touched = e.touched
+    _, truncated, err := e.graph.netCycles(context.Background(), opts)
+
+    // A cut-short run may have left cycles anywhere, so the next one
+    // searches everything
+    if truncated || err != nil {
+        e.touched = nil
+    } else {
+        e.touched = make(map[string]bool)
+    }
+    return e.graph.ToIntents()
+}
+
+// Preview returns what Settle would leave and the steps it would take,
+// without netting the engine's graph
+func (e *NettingEngine) Preview() ([]Intent, []NettingOp) {
+    e.mu.RLock()
+    c := e.graph.Clone()
+    opts := e.opts
+    if e.touched != nil {
+        // Copied, as AddIntent may write to it once the lock is released
+        opts.touched = make(map[string]bool, len(e.touched))
+        for node := range e.touched {
+            opts.touched[node] = true
+        }
+    }
+    e.mu.RUnlock()
+
+    ops, _, _ := c.netCycles(context.Background(), opts)
+    return c.ToIntents(), ops
+}
+
+// Intents returns the outstanding intents without netting them
+func (e *NettingEngine) Intents() []Intent {
+    e.mu.RLock()
+    defer e.mu.RUnlock()
+    return e.graph.ToIntents()
+}
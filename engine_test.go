@@ -0,0 +1,70 @@
+package netting
+
+import (
+    "math/rand"
+    "sync"
+    "testing"
+)
+
+// Run with -race to check the locking
+func TestNettingEngineConcurrent(t *testing.T) {
+    e := NewNettingEngine()
+    const writers, perWriter = 8, 200
+
+    batches := make([][]Intent, writers)
+    for w := range batches {
+        batches[w] = randomIntents(rand.New(rand.NewSource(int64(w))), 10, 2, perWriter)
+    }
+
+    var wg sync.WaitGroup
+    for w := 0; w < writers; w++ {
+        wg.Add(1)
+        go func(intents []Intent) {
+            defer wg.Done()
+            for _, intent := range intents {
+                if err := e.AddIntent(intent); err != nil {
+                    t.Error(err)
+                    return
+                }
+            }
+        }(batches[w])
+    }
+
+    done := make(chan struct{})
+    var readers sync.WaitGroup
+    readers.Add(2)
+    go func() {
+        defer readers.Done()
+        for {
+            select {
+            case <-done:
+                return
+            default:
+                e.Settle()
+            }
+        }
+    }()
+    go func() {
+        defer readers.Done()
+        for {
+            select {
+            case <-done:
+                return
+            default:
+                e.Preview()
+                e.Intents()
+            }
+        }
+    }()
+    wg.Wait()
+    close(done)
+    readers.Wait()
+
+    var all []Intent
+    for _, batch := range batches {
+        all = append(all, batch...)
+    }
+    if err := VerifyConservation(all, e.Settle()); err != nil {
+        t.Error(err)
+    }
+}
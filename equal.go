@@ -0,0 +1,78 @@
+package netting
+
+import (
+    "fmt"
+    "time"
+)
+
+// Equal reports whether g and other hold the same debts: the same amount on
+// every edge, whatever the order of each node's edges. Refs, which only
+// trace where debts came from, are not compared, and a zero edge counts as
+// no edge.
+func (g *GraphOf[N]) Equal(other *GraphOf[N]) bool {
+    count := func(g *GraphOf[N]) map[EdgeKeyOf[N]]uint64 {
+        amounts := make(map[EdgeKeyOf[N]]uint64)
+        for from, edges := range g.Edges {
+            for _, edge := range edges {
+                if edge.Amount > 0 {
+                    amounts[EdgeKeyOf[N]{From: from, To: edge.To, Token: edge.Token}] = edge.Amount
+                }
+            }
+        }
+        return amounts
+    }
+    a, b := count(g), count(other)
+    if len(a) != len(b) {
+        return false
+    }
+    for key, amount := range a {
+        if b[key] != amount {
+            return false
+        }
+    }
+    return true
+}
+
+// intentKey is the comparable form of an intent
+type intentKey[N comparable] struct {
+    sender, receiver N
+    token            string
+    amount           uint64
+    id, refs         string
+    expiresAt        time.Time
+    reverse          bool
+}
+
+// IntentsEqual reports whether a and b hold the same intents the same
+// number of times, in any order. Every field is compared, with ExpiresAt
+// compared as an instant.
+func IntentsEqual[N comparable](a, b []IntentOf[N]) bool {
+    if len(a) != len(b) {
+        return false
+    }
+    key := func(intent IntentOf[N]) intentKey[N] {
+        return intentKey[N]{
+            sender:    intent.Sender,
+            receiver:  intent.Receiver,
+            token:     intent.Token,
+            amount:    intent.Amount,
+            id:        intent.ID,
+            // Quoting keeps distinct lists apart; nil and empty match
+            refs:      fmt.Sprintf("%q", intent.Refs),
+            expiresAt: intent.ExpiresAt.UTC().Round(0),
+            reverse:   intent.Reverse,
+        }
+    }
+    counts := make(map[intentKey[N]]int)
+    for _, intent := range a {
+        counts[key(intent)]++
+    }
+    for _, intent := range b {
+        k := key(intent)
+        if counts[k] == 0 {
+            return false
+        }
+        counts[k]--
+    }
+    return true
+}
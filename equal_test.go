@@ -0,0 +1,63 @@
+package netting
+
+import (
+    "testing"
+    "time"
+)
+
+func TestGraphEqual(t *testing.T) {
+    g := NewGraph()
+    g.AddEdge("A", "B", "T", 5)
+    g.AddEdge("A", "C", "T", 3)
+    g.AddEdge("B", "C", "U", 1)
+
+    // The same debts added in another order, one of them in two parts
+    other := NewGraph()
+    other.AddEdge("B", "C", "U", 1)
+    other.AddEdge("A", "C", "T", 3)
+    other.AddEdge("A", "B", "T", 2)
+    other.AddEdge("A", "B", "T", 3)
+    if !g.Equal(other) || !other.Equal(g) {
+        t.Error("graphs with the same debts are not Equal")
+    }
+
+    other.AddEdge("A", "B", "T", 1)
+    if g.Equal(other) {
+        t.Error("graphs with different amounts are Equal")
+    }
+    if g.Equal(NewGraph()) {
+        t.Error("graph Equal to an empty one")
+    }
+}
+
+func TestIntentsEqual(t *testing.T) {
+    at := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+    a := []Intent{
+        {Sender: "A", Receiver: "B", Token: "T", Amount: 5, ID: "tx1"},
+        {Sender: "A", Receiver: "B", Token: "T", Amount: 5, ID: "tx1"},
+        {Sender: "B", Receiver: "C", Token: "T", Amount: 2, Refs: []string{"tx2"}, ExpiresAt: at},
+    }
+    // Reordered, with the expiry given in another zone
+    b := []Intent{
+        {Sender: "B", Receiver: "C", Token: "T", Amount: 2, Refs: []string{"tx2"}, ExpiresAt: at.In(time.FixedZone("X", 3600))},
+        {Sender: "A", Receiver: "B", Token: "T", Amount: 5, ID: "tx1"},
+        {Sender: "A", Receiver: "B", Token: "T", Amount: 5, ID: "tx1"},
+    }
+    if !IntentsEqual(a, b) {
+        t.Error("intents in a different order are not equal")
+    }
+
+    for _, c := range []struct {
+        name string
+        b    []Intent
+    }{
+        {"fewer copies", []Intent{a[0], a[2], a[2]}},
+        {"missing intent", a[:2]},
+        {"other amount", []Intent{a[0], a[1], {Sender: "B", Receiver: "C", Token: "T", Amount: 3, Refs: []string{"tx2"}, ExpiresAt: at}}},
+        {"other refs", []Intent{a[0], a[1], {Sender: "B", Receiver: "C", Token: "T", Amount: 2, ExpiresAt: at}}},
+    } {
+        if IntentsEqual(a, c.b) {
+            t.Errorf("%s: intents are equal", c.name)
+        }
+    }
+}
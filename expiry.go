@@ -0,0 +1,37 @@
+package netting
+
+import (
+    "fmt"
+    "time"
+)
+
+// expired reports whether intent has lapsed at now
+func (intent IntentOf[N]) expired(now time.Time) bool {
+    return !intent.ExpiresAt.IsZero() && !now.Before(intent.ExpiresAt)
+}
+
+// live returns intents less those expired at o.Now, and how many were
+// dropped, which is also logged. All intents are validated first so errors
+// give their position in the input. A zero Now drops nothing.
+func (o OptionsOf[N]) live(intents []IntentOf[N]) ([]IntentOf[N], int, error) {
+    if o.Now.IsZero() {
+        return intents, 0, nil
+    }
+    for i, intent := range intents {
+        if err := validateIntent(intent); err != nil {
+            return nil, 0, fmt.Errorf("intent %d: %w", i, err)
+        }
+    }
+
+    live := make([]IntentOf[N], 0, len(intents))
+    for _, intent := range intents {
+        if !intent.expired(o.Now) {
+            live = append(live, intent)
+        }
+    }
+    dropped := len(intents) - len(live)
+    if dropped > 0 && o.Logger != nil {
+        o.Logger.Printf("netting: dropped %d intents expired at %v", dropped, o.Now)
+    }
+    return live, dropped, nil
+}
@@ -0,0 +1,69 @@
+package netting
+
+import (
+    "encoding/json"
+    "reflect"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestExpiredIntentsDropped(t *testing.T) {
+    now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+    intents := []Intent{
+        {Sender: "A", Receiver: "B", Token: "T", Amount: 10},
+        {Sender: "B", Receiver: "C", Token: "T", Amount: 10, ExpiresAt: now.Add(time.Hour)},
+        // Expired an hour ago, and exactly now
+        {Sender: "C", Receiver: "A", Token: "T", Amount: 10, ExpiresAt: now.Add(-time.Hour)},
+        {Sender: "C", Receiver: "A", Token: "T", Amount: 5, ExpiresAt: now},
+        {Sender: "C", Receiver: "A", Token: "T", Amount: 4},
+    }
+    out, stats, err := ProcessNettingWithStatsOptions(intents, Options{Now: now})
+    if err != nil {
+        t.Fatal(err)
+    }
+    // Only the live 4 of C -> A nets
+    want := []Intent{
+        {Sender: "A", Receiver: "B", Token: "T", Amount: 6},
+        {Sender: "B", Receiver: "C", Token: "T", Amount: 6},
+    }
+    if !reflect.DeepEqual(out, want) {
+        t.Errorf("residual = %v, want %v", out, want)
+    }
+    if stats.ExpiredDropped != 2 {
+        t.Errorf("ExpiredDropped = %d, want 2", stats.ExpiredDropped)
+    }
+
+    // Without Now nothing expires
+    out, err = ProcessNettingWithOptions(intents, Options{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if want := []Intent{{Sender: "C", Receiver: "A", Token: "T", Amount: 9}}; !reflect.DeepEqual(out, want) {
+        t.Errorf("residual without Now = %v, want %v", out, want)
+    }
+}
+
+func TestExpiresAtJSON(t *testing.T) {
+    // omitzero, which needs Go 1.24, leaves out an unset expiry
+    data, err := json.Marshal(Intent{Sender: "A", Receiver: "B", Token: "T", Amount: 1})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if want := `{"sender":"A","receiver":"B","token":"T","amount":1}`; string(data) != want {
+        t.Errorf("Marshal = %s, want %s", data, want)
+    }
+
+    expiring := Intent{Sender: "A", Receiver: "B", Token: "T", Amount: 1, ExpiresAt: time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)}
+    data, err = json.Marshal(expiring)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !strings.Contains(string(data), `"expires_at":"2030-01-02T03:04:05Z"`) {
+        t.Errorf("Marshal = %s, want expires_at set", data)
+    }
+    var back Intent
+    if err := json.Unmarshal(data, &back); err != nil || !reflect.DeepEqual(back, expiring) {
+        t.Errorf("Unmarshal = %v, %v, want %v", back, err, expiring)
+    }
+}
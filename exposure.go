@@ -0,0 +1,46 @@
+package netting
+
+import (
+    "fmt"
+    "math"
+)
+
+// ExposurePair is a participant's outgoing exposure in one token
+type ExposurePair struct {
+    // Gross is the total the participant owes
+    Gross uint64 `json:"gross"`
+    // Net is what it owes once each counterparty's debts back to it are
+    // offset, summed over the counterparties it remains a net debtor of
+    Net uint64 `json:"net"`
+}
+
+// Exposure returns node's gross and net outgoing exposure per token. Only
+// tokens node owes are present. Debts owed to node are read from the reverse
+// index if enabled. ErrAmountOverflow is returned if a gross total does not
+// fit in a uint64.
+func (g *GraphOf[N]) Exposure(node N) (map[string]ExposurePair, error) {
+    exposure := make(map[string]ExposurePair)
+    for _, edge := range g.Edges[node] {
+        pair := exposure[edge.Token]
+        if pair.Gross > math.MaxUint64-edge.Amount {
+            return nil, fmt.Errorf("gross %s exposure of %v: %w", edge.Token, node, ErrAmountOverflow)
+        }
+        pair.Gross += edge.Amount
+        exposure[edge.Token] = pair
+    }
+
+    // Offset each debt by what the same counterparty owes back
+    owedBack := make(map[edgeKey[N]]uint64)
+    for _, in := range g.InEdges(node) {
+        owedBack[edgeKey[N]{in.To, in.Token}] = in.Amount
+    }
+    for _, edge := range g.Edges[node] {
+        if back := owedBack[edgeKey[N]{edge.To, edge.Token}]; edge.Amount > back {
+            // Bounded by the gross total, so this cannot overflow
+            pair := exposure[edge.Token]
+            pair.Net += edge.Amount - back
+            exposure[edge.Token] = pair
+        }
+    }
+    return exposure, nil
+}
@@ -0,0 +1,34 @@
+package netting
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestExposure(t *testing.T) {
+    // A owes 15 T gross; B owes 3 back, so 7 net to B, and C owes 8 back,
+    // more than A owes it, so nothing net to C
+    for _, reverse := range []bool{false, true} {
+        g := NewGraph()
+        if reverse {
+            g.EnableReverseIndex()
+        }
+        g.AddEdge("A", "B", "T", 10)
+        g.AddEdge("A", "C", "T", 5)
+        g.AddEdge("A", "D", "U", 4)
+        g.AddEdge("B", "A", "T", 3)
+        g.AddEdge("C", "A", "T", 8)
+
+        got, err := g.Exposure("A")
+        if err != nil {
+            t.Fatal(err)
+        }
+        want := map[string]ExposurePair{
+            "T": {Gross: 15, Net: 7},
+            "U": {Gross: 4, Net: 4},
+        }
+        if !reflect.DeepEqual(got, want) {
+            t.Errorf("reverse index %v: Exposure(A) = %v, want %v", reverse, got, want)
+        }
+    }
+}
@@ -0,0 +1,59 @@
+package netting
+
+import "context"
+
+// netFairly nets candidates in passes, each taking half of what a candidate
+// can still net, rounded up, until a pass nets nothing. It returns one step
+// per candidate that netted anything, in candidate order.
+func (g *GraphOf[N]) netFairly(ctx context.Context, candidates []candidate[N], opts OptionsOf[N]) ([]NettingOpOf[N], error) {
+    totals := make([]uint64, len(candidates))
+    active := make([]int, len(candidates))
+    for i := range active {
+        active[i] = i
+    }
+
+    var err error
+    steps := 0
+    for len(active) > 0 && err == nil {
+        // Candidates with nothing left drop out for good, as netting only
+        // ever lowers edges
+        kept := active[:0]
+        for _, i := range active {
+            steps++
+            if steps%ctxCheckInterval == 0 {
+                if err = ctx.Err(); err != nil {
+                    break
+                }
+            }
+
+            c := candidates[i]
+            amount, ok := g.CalculateNettingRetaining(c.cycle, c.token, opts.MinRetain)
+            if !ok || amount == 0 {
+                continue
+            }
+            share := amount/2 + amount%2
+            if err = g.ApplyNetting(c.cycle, c.token, share); err != nil {
+                break
+            }
+            totals[i] += share
+            kept = append(kept, i)
+        }
+        active = kept
+    }
+
+    // Report what was netted even if the passes were cut short
+    ops := make([]NettingOpOf[N], 0)
+    for i, c := range candidates {
+        if totals[i] == 0 {
+            continue
+        }
+        op := NettingOpOf[N]{
+            Cycle:  append([]N(nil), c.cycle...),
+            Token:  c.token,
+            Amount: totals[i],
+        }
+        opts.applied(op)
+        ops = append(ops, op)
+    }
+    return ops, err
+}
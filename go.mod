@@ -1,3 +1,3 @@
 module bhaskar1001101/go-netting
 
-go 1.23.2
+go 1.24
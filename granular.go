@@ -0,0 +1,91 @@
+package netting
+
+// residuals returns what netting left of intents in g, shaped as
+// opts.PreserveIntents and opts.IncludeZeroResiduals ask: by default one
+// intent per remaining edge, as ToIntents gives
+func (g *GraphOf[N]) residuals(intents []IntentOf[N], opts OptionsOf[N]) []IntentOf[N] {
+    if opts.PreserveIntents {
+        return g.splitResiduals(intents, opts.IncludeZeroResiduals)
+    }
+    result := g.ToIntents()
+    if !opts.IncludeZeroResiduals {
+        return result
+    }
+
+    // Edges netted away entirely are gone from g, so they are recovered from
+    // intents along with the refs they had gathered
+    cleared := make(map[EdgeKeyOf[N]]int)
+    for _, intent := range intents {
+        if intent.Sender == intent.Receiver {
+            continue
+        }
+        if _, ok := g.GetEdge(intent.Sender, intent.Receiver, intent.Token); ok {
+            continue
+        }
+        key := EdgeKeyOf[N]{From: intent.Sender, To: intent.Receiver, Token: intent.Token}
+        i, ok := cleared[key]
+        if !ok {
+            i = len(result)
+            cleared[key] = i
+            result = append(result, IntentOf[N]{Sender: intent.Sender, Receiver: intent.Receiver, Token: intent.Token})
+        }
+        result[i].Refs = append(result[i].Refs, intent.refs()...)
+    }
+    sortIntents(result, g.compare)
+    return result
+}
+
+// splitResiduals expands each edge of intents into the intents it was built
+// from, for Options.PreserveIntents. Netting is charged to an edge's intents
+// in input order, so its residual is made up of the latest of them and only
+// the earliest of those is reduced. Intents netted away entirely are kept
+// with a zero Amount if zeros is set. Edges come in ToIntents order and each
+// edge's intents in input order.
+func (g *GraphOf[N]) splitResiduals(intents []IntentOf[N], zeros bool) []IntentOf[N] {
+    sources := make(map[EdgeKeyOf[N]][]IntentOf[N])
+    edges := make([]IntentOf[N], 0)
+    for _, intent := range intents {
+        // Reversals are charged as netting would be, to the earliest debts
+        if intent.Sender == intent.Receiver || intent.Reverse {
+            continue
+        }
+        key := EdgeKeyOf[N]{From: intent.Sender, To: intent.Receiver, Token: intent.Token}
+        if sources[key] == nil {
+            edges = append(edges, IntentOf[N]{Sender: intent.Sender, Receiver: intent.Receiver, Token: intent.Token})
+        }
+        sources[key] = append(sources[key], intent)
+    }
+    sortIntents(edges, g.compare)
+
+    result := make([]IntentOf[N], 0)
+    for _, edge := range edges {
+        contributing := sources[EdgeKeyOf[N]{From: edge.Sender, To: edge.Receiver, Token: edge.Token}]
+        residual, _ := g.GetEdge(edge.Sender, edge.Receiver, edge.Token)
+
+        // Walk back from the latest intent until the residual is covered
+        start := len(contributing)
+        for remaining := residual; start > 0 && remaining > 0; {
+            start--
+            if contributing[start].Amount < remaining {
+                remaining -= contributing[start].Amount
+                continue
+            }
+            contributing[start].Amount = remaining
+            remaining = 0
+        }
+        if zeros {
+            for i := 0; i < start; i++ {
+                contributing[i].Amount = 0
+            }
+            start = 0
+        }
+
+        for _, intent := range contributing[start:] {
+            if intent.Refs != nil {
+                intent.Refs = append([]string(nil), intent.Refs...)
+            }
+            result = append(result, intent)
+        }
+    }
+    return result
+}
@@ -0,0 +1,67 @@
+package netting
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestPreserveIntents(t *testing.T) {
+    intents := []Intent{
+        {Sender: "A", Receiver: "B", Token: "T", Amount: 40, ID: "tx1"},
+        {Sender: "A", Receiver: "B", Token: "T", Amount: 60, ID: "tx2"},
+        {Sender: "A", Receiver: "B", Token: "T", Amount: 30, ID: "tx3"},
+        {Sender: "B", Receiver: "A", Token: "T", Amount: 50, ID: "tx4"},
+    }
+    out, err := ProcessNettingWithOptions(intents, Options{PreserveIntents: true})
+    if err != nil {
+        t.Fatal(err)
+    }
+    // The 50 netted is charged to tx1, then 10 of tx2
+    want := []Intent{
+        {Sender: "A", Receiver: "B", Token: "T", Amount: 50, ID: "tx2"},
+        {Sender: "A", Receiver: "B", Token: "T", Amount: 30, ID: "tx3"},
+    }
+    if !reflect.DeepEqual(out, want) {
+        t.Errorf("residual = %v, want %v", out, want)
+    }
+}
+
+func TestIncludeZeroResiduals(t *testing.T) {
+    intents := append(triangle("T", 5), Intent{Sender: "A", Receiver: "B", Token: "T", Amount: 3, ID: "tx4"})
+    rest := []Intent{{Sender: "A", Receiver: "B", Token: "T", Amount: 3, Refs: []string{"tx4"}}}
+
+    out, err := ProcessNettingWithOptions(intents, Options{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !reflect.DeepEqual(out, rest) {
+        t.Errorf("default residual = %v, want %v", out, rest)
+    }
+
+    out, err = ProcessNettingWithOptions(intents, Options{IncludeZeroResiduals: true})
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := append(rest,
+        Intent{Sender: "B", Receiver: "C", Token: "T", Amount: 0},
+        Intent{Sender: "C", Receiver: "A", Token: "T", Amount: 0},
+    )
+    if !reflect.DeepEqual(out, want) {
+        t.Errorf("residual with zeros = %v, want %v", out, want)
+    }
+
+    // With PreserveIntents each netted intent gets its own zero
+    out, err = ProcessNettingWithOptions(intents, Options{IncludeZeroResiduals: true, PreserveIntents: true})
+    if err != nil {
+        t.Fatal(err)
+    }
+    want = []Intent{
+        {Sender: "A", Receiver: "B", Token: "T", Amount: 0},
+        {Sender: "A", Receiver: "B", Token: "T", Amount: 3, ID: "tx4"},
+        {Sender: "B", Receiver: "C", Token: "T", Amount: 0},
+        {Sender: "C", Receiver: "A", Token: "T", Amount: 0},
+    }
+    if !reflect.DeepEqual(out, want) {
+        t.Errorf("preserved residual with zeros = %v, want %v", out, want)
+    }
+}
@@ -0,0 +1,59 @@
+package netting
+
+import (
+    "fmt"
+    "io"
+    "net/http"
+    "strconv"
+)
+
+// maxRequestBytes bounds the size of a batch accepted by NettingHandler
+const maxRequestBytes = 10 << 20
+
+// NettingHandler nets the JSON array of intents POSTed to it and responds
+// with the remaining intents as a JSON array. The optional maxCycleLength
+// query parameter sets Options.MaxCycleLength. Malformed or invalid batches
+// get a 400 response with the error as plain text.
+func NettingHandler(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        w.Header().Set("Allow", http.MethodPost)
+        http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+
+    var opts Options
+    if v := r.URL.Query().Get("maxCycleLength"); v != "" {
+        n, err := strconv.Atoi(v)
+        if err != nil {
+            http.Error(w, fmt.Sprintf("maxCycleLength: %v", err), http.StatusBadRequest)
+            return
+        }
+        opts.MaxCycleLength = n
+    }
+
+    body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBytes))
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    intents, err := IntentsFromJSON(body)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    // Every error from netting is down to the intents or options sent
+    netted, err := ProcessNettingWithOptions(intents, opts)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    out, err := IntentsToJSON(netted)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    w.Header().Set("Content-Type", "application/json")
+    w.Write(out)
+}
@@ -0,0 +1,67 @@
+package netting
+
+import (
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+)
+
+func TestNettingHandler(t *testing.T) {
+    srv := httptest.NewServer(http.HandlerFunc(NettingHandler))
+    defer srv.Close()
+
+    post := func(query, body string) (*http.Response, []Intent) {
+        t.Helper()
+        resp, err := http.Post(srv.URL+query, "application/json", strings.NewReader(body))
+        if err != nil {
+            t.Fatal(err)
+        }
+        defer resp.Body.Close()
+        var buf strings.Builder
+        if _, err := io.Copy(&buf, resp.Body); err != nil {
+            t.Fatal(err)
+        }
+        if resp.StatusCode != http.StatusOK {
+            return resp, nil
+        }
+        intents, err := IntentsFromJSON([]byte(buf.String()))
+        if err != nil {
+            t.Fatal(err)
+        }
+        return resp, intents
+    }
+
+    batch := `[
+        {"sender": "A", "receiver": "B", "token": "T", "amount": 10},
+        {"sender": "B", "receiver": "C", "token": "T", "amount": 10},
+        {"sender": "C", "receiver": "A", "token": "T", "amount": 4}
+    ]`
+    resp, out := post("", batch)
+    if resp.StatusCode != http.StatusOK {
+        t.Fatalf("valid batch: status %d", resp.StatusCode)
+    }
+    want := []Intent{
+        {Sender: "A", Receiver: "B", Token: "T", Amount: 6},
+        {Sender: "B", Receiver: "C", Token: "T", Amount: 6},
+    }
+    if !IntentsEqual(out, want) {
+        t.Errorf("valid batch: got %v, want %v", out, want)
+    }
+
+    // With cycles capped at 2 hops the triangle is left alone
+    if _, out := post("?maxCycleLength=2", batch); len(out) != 3 {
+        t.Errorf("maxCycleLength=2: got %v, want the batch unchanged", out)
+    }
+
+    for _, tt := range []struct{ name, query, body string }{
+        {"zero amount", "", `[{"sender": "A", "receiver": "B", "token": "T", "amount": 0}]`},
+        {"malformed", "", `[{"sender": "A"`},
+        {"bad option", "?maxCycleLength=1", batch},
+    } {
+        if resp, _ := post(tt.query, tt.body); resp.StatusCode != http.StatusBadRequest {
+            t.Errorf("%s: status %d, want 400", tt.name, resp.StatusCode)
+        }
+    }
+}
@@ -0,0 +1,62 @@
+package netting
+
+import (
+    "encoding/json"
+    "fmt"
+    "sort"
+)
+
+// graphJSON is the wire format of a Graph
+type graphJSON[N comparable] struct {
+    Edges map[N][]EdgeOf[N] `json:"edges"`
+}
+
+// ToJSON encodes the full edge map of g. N must be usable as a JSON object
+// key: a string or integer type, or one implementing encoding.TextMarshaler.
+func (g *GraphOf[N]) ToJSON() ([]byte, error) {
+    return json.Marshal(graphJSON[N]{Edges: g.Edges})
+}
+
+// GraphFromJSON decodes a graph written by ToJSON. Edges are added with
+// AddEdge, so repeated edges are accumulated as usual.
+func GraphFromJSON(data []byte) (*Graph, error) {
+    var decoded graphJSON[string]
+    if err := json.Unmarshal(data, &decoded); err != nil {
+        return nil, err
+    }
+
+    // Add in node order so the graph does not depend on map iteration
+    froms := make([]string, 0, len(decoded.Edges))
+    for from := range decoded.Edges {
+        froms = append(froms, from)
+    }
+    sort.Strings(froms)
+
+    g := NewGraph()
+    for _, from := range froms {
+        for _, edge := range decoded.Edges[from] {
+            if err := g.addEdge(from, edge.To, edge.Token, edge.Amount, edge.Refs); err != nil {
+                return nil, fmt.Errorf("edge %s -> %s: %w", from, edge.To, err)
+            }
+        }
+    }
+    return g, nil
+}
+
+// IntentsToJSON encodes intents as a JSON array
+func IntentsToJSON(intents []Intent) ([]byte, error) {
+    if intents == nil {
+        intents = []Intent{}
+    }
+    return json.Marshal(intents)
+}
+
+// IntentsFromJSON decodes a JSON array of intents. The intents are not
+// validated; ProcessNetting does that.
+func IntentsFromJSON(data []byte) ([]Intent, error) {
+    intents := make([]Intent, 0)
+    if err := json.Unmarshal(data, &intents); err != nil {
+        return nil, err
+    }
+    return intents, nil
+}
@@ -0,0 +1,53 @@
+package netting
+
+import (
+    "math"
+    "math/rand"
+    "reflect"
+    "testing"
+)
+
+func TestGraphJSONRoundTrip(t *testing.T) {
+    g, _, err := buildGraph(randomIntents(rand.New(rand.NewSource(1)), 8, 3, 40))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := g.AddEdge("big", "n0", "t0", math.MaxUint64); err != nil {
+        t.Fatal(err)
+    }
+    g.Edges["n1"][0].Refs = []string{"r1", "r2"}
+
+    data, err := g.ToJSON()
+    if err != nil {
+        t.Fatal(err)
+    }
+    back, err := GraphFromJSON(data)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !reflect.DeepEqual(back.Edges, g.Edges) {
+        t.Errorf("round trip changed edges:\n%v\nwant\n%v", back.Edges, g.Edges)
+    }
+}
+
+func TestIntentsJSONRoundTrip(t *testing.T) {
+    intents := []Intent{
+        {Sender: "A", Receiver: "B", Token: "T", Amount: math.MaxUint64, ID: "x"},
+        {Sender: "B", Receiver: "A", Token: "U", Amount: 1, Refs: []string{"y", "z"}, Reverse: true},
+    }
+    data, err := IntentsToJSON(intents)
+    if err != nil {
+        t.Fatal(err)
+    }
+    back, err := IntentsFromJSON(data)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !reflect.DeepEqual(back, intents) {
+        t.Errorf("round trip = %v, want %v", back, intents)
+    }
+
+    if data, _ := IntentsToJSON(nil); string(data) != "[]" {
+        t.Errorf("IntentsToJSON(nil) = %s, want []", data)
+    }
+}
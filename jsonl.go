@@ -0,0 +1,52 @@
+package netting
+
+import (
+    "bufio"
+    "bytes"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+)
+
+// ReadIntentsJSONL reads newline-delimited JSON intents from r, one object
+// per line, and passes each to fn as it is decoded, so a stream of any size
+// is read in bounded memory. Blank lines are skipped. Reading stops at the
+// first malformed line or error from fn, which is returned with its line
+// number. The intents are not validated; passing NettingEngine.AddIntent as
+// fn validates each as it is added.
+func ReadIntentsJSONL(r io.Reader, fn func(Intent) error) error {
+    br := bufio.NewReader(r)
+    for line := 1; ; line++ {
+        data, err := br.ReadBytes('\n')
+        if err != nil && !errors.Is(err, io.EOF) {
+            return fmt.Errorf("line %d: %w", line, err)
+        }
+        if data = bytes.TrimSpace(data); len(data) > 0 {
+            var intent Intent
+            if err := json.Unmarshal(data, &intent); err != nil {
+                return fmt.Errorf("line %d: %w", line, err)
+            }
+            if err := fn(intent); err != nil {
+                return fmt.Errorf("line %d: %w", line, err)
+            }
+        }
+        if err != nil {
+            return nil
+        }
+    }
+}
+
+// LoadIntentsJSONL reads all the newline-delimited JSON intents in r, as
+// ReadIntentsJSONL does
+func LoadIntentsJSONL(r io.Reader) ([]Intent, error) {
+    intents := make([]Intent, 0)
+    err := ReadIntentsJSONL(r, func(intent Intent) error {
+        intents = append(intents, intent)
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+    return intents, nil
+}
@@ -0,0 +1,40 @@
+package netting
+
+import (
+    "reflect"
+    "strings"
+    "testing"
+)
+
+func TestLoadIntentsJSONL(t *testing.T) {
+    good := `{"sender":"A","receiver":"B","token":"T","amount":10}
+
+{"sender":"B","receiver":"C","token":"T","amount":5}
+`
+    intents, err := LoadIntentsJSONL(strings.NewReader(good + `{"sender":"C","receiver":"A","token":"T","amount":3}`))
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := []Intent{
+        {Sender: "A", Receiver: "B", Token: "T", Amount: 10},
+        {Sender: "B", Receiver: "C", Token: "T", Amount: 5},
+        {Sender: "C", Receiver: "A", Token: "T", Amount: 3},
+    }
+    if !reflect.DeepEqual(intents, want) {
+        t.Errorf("LoadIntentsJSONL = %v, want %v", intents, want)
+    }
+
+    // The blank line still counts, so the bad one is line 4
+    bad := good + `{"sender":"C","receiver":` + "\n" + `{"sender":"C","receiver":"A","token":"T","amount":3}` + "\n"
+    var read []Intent
+    err = ReadIntentsJSONL(strings.NewReader(bad), func(intent Intent) error {
+        read = append(read, intent)
+        return nil
+    })
+    if err == nil || !strings.HasPrefix(err.Error(), "line 4: ") {
+        t.Errorf("ReadIntentsJSONL error = %v, want one for line 4", err)
+    }
+    if !reflect.DeepEqual(read, want[:2]) {
+        t.Errorf("read %v before the bad line, want %v", read, want[:2])
+    }
+}
@@ -0,0 +1,29 @@
+package netting
+
+// AdjacencyMatrix returns g's debts in token as a dense matrix, where
+// matrix[i][j] is what nodes[i] owes nodes[j]. nodes is Nodes, every
+// participant in g and not only those with debts in token, so matrices for
+// different tokens of one graph share the same ordering.
+func (g *GraphOf[N]) AdjacencyMatrix(token string) ([]N, [][]uint64) {
+    nodes := g.Nodes()
+    index := make(map[N]int, len(nodes))
+    for i, node := range nodes {
+        index[node] = i
+    }
+
+    // One backing array keeps the matrix contiguous
+    cells := make([]uint64, len(nodes)*len(nodes))
+    matrix := make([][]uint64, len(nodes))
+    for i := range matrix {
+        matrix[i] = cells[i*len(nodes) : (i+1)*len(nodes) : (i+1)*len(nodes)]
+    }
+
+    for from, edges := range g.Edges {
+        for _, edge := range edges {
+            if edge.Token == token {
+                matrix[index[from]][index[edge.To]] = edge.Amount
+            }
+        }
+    }
+    return nodes, matrix
+}
@@ -0,0 +1,42 @@
+package netting
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestAdjacencyMatrix(t *testing.T) {
+    g := NewGraph()
+    g.AddEdge("A", "B", "T", 10)
+    g.AddEdge("B", "C", "T", 4)
+    g.AddEdge("C", "A", "T", 7)
+    g.AddEdge("A", "C", "U", 3)
+    g.AddEdge("D", "A", "U", 2)
+
+    nodes, matrix := g.AdjacencyMatrix("T")
+    wantNodes := []string{"A", "B", "C", "D"}
+    // D has no T debts but keeps its row and column
+    wantMatrix := [][]uint64{
+        {0, 10, 0, 0},
+        {0, 0, 4, 0},
+        {7, 0, 0, 0},
+        {0, 0, 0, 0},
+    }
+    if !reflect.DeepEqual(nodes, wantNodes) {
+        t.Errorf("nodes = %v, want %v", nodes, wantNodes)
+    }
+    if !reflect.DeepEqual(matrix, wantMatrix) {
+        t.Errorf("T matrix = %v, want %v", matrix, wantMatrix)
+    }
+
+    _, matrix = g.AdjacencyMatrix("U")
+    wantMatrix = [][]uint64{
+        {0, 0, 3, 0},
+        {0, 0, 0, 0},
+        {0, 0, 0, 0},
+        {2, 0, 0, 0},
+    }
+    if !reflect.DeepEqual(matrix, wantMatrix) {
+        t.Errorf("U matrix = %v, want %v", matrix, wantMatrix)
+    }
+}
@@ -0,0 +1,1270 @@
+// Package netting reduces sets of payment intents by offsetting debts that
+// form cycles in the debt graph.
+package netting
+
+import (
+    "cmp"
+    "context"
+    "errors"
+    "fmt"
+    "math"
+    "slices"
+    "sort"
+    "time"
+)
+
+// ErrAmountOverflow is returned when accumulating amounts would exceed the
+// range of uint64
+var ErrAmountOverflow = errors.New("amount overflows uint64")
+
+// ErrSelfLoop is returned when adding an edge from a node to itself. Such a
+// debt nets against nothing and would only pollute the cycle search.
+var ErrSelfLoop = errors.New("sender and receiver are the same")
+
+// IntentOf is a debt of Amount units of Token from Sender to Receiver, with
+// participants identified by N
+type IntentOf[N comparable] struct {
+    Sender    N      `json:"sender"`
+    Receiver  N      `json:"receiver"`
+    Token     string `json:"token"`
+    Amount    uint64 `json:"amount"`
+
+    // ID optionally identifies the intent, such as by its originating
+    // transaction, so results can be traced back to it
+    ID string `json:"id,omitempty"`
+
+    // Refs lists the IDs of the intents a netting result derives from:
+    // every intent merged into its edge, in the order they were added
+    Refs []string `json:"refs,omitempty"`
+
+    // ExpiresAt, if set, is when the intent lapses. Netting with
+    // Options.Now at or after it drops the intent before any edge is built.
+    ExpiresAt time.Time `json:"expires_at,omitzero"`
+
+    // Reverse marks a reversal, such as a refund, that cancels Amount of
+    // the debt from Sender to Receiver added by earlier intents instead of
+    // adding to it. Netting never returns reversals.
+    Reverse bool `json:"reverse,omitempty"`
+}
+
+// Intent is an IntentOf with string participant identifiers
+type Intent = IntentOf[string]
+
+// ErrReversalExceedsDebt is returned when a reversal cancels more than is
+// owed on its edge
+var ErrReversalExceedsDebt = errors.New("reversal exceeds outstanding debt")
+
+// refs returns the IDs the edge built from the intent should carry: its own
+// ID, if any, followed by those it was derived from
+func (intent IntentOf[N]) refs() []string {
+    if intent.ID == "" {
+        return intent.Refs
+    }
+    return append([]string{intent.ID}, intent.Refs...)
+}
+
+// EdgeOf represents a directed edge in the graph with token and amount
+type EdgeOf[N comparable] struct {
+    To     N      `json:"to"`
+    Token  string `json:"token"`
+    Amount uint64 `json:"amount"`
+
+    // Refs lists the IDs of the intents accumulated into the edge
+    Refs []string `json:"refs,omitempty"`
+}
+
+// Edge is an EdgeOf with string participant identifiers
+type Edge = EdgeOf[string]
+
+// GraphOf represents the debt network between participants identified by N
+type GraphOf[N comparable] struct {
+    // map[from][]Edge
+    Edges map[N][]EdgeOf[N]
+
+    // index locates each edge in Edges, map[from][{to, token}]position, so
+    // lookups do not scan a node's edges. It is built lazily per node.
+    index map[N]map[edgeKey[N]]int
+
+    // reverse is the opt-in predecessor index, map[to][]Edge with To set to
+    // the debtor. It is nil unless EnableReverseIndex has been called.
+    reverse map[N][]EdgeOf[N]
+
+    // compare orders nodes so that results are deterministic
+    compare func(a, b N) int
+}
+
+// Graph is a GraphOf with string participant identifiers
+type Graph = GraphOf[string]
+
+// edgeKey identifies an edge among those leaving one node
+type edgeKey[N comparable] struct {
+    to    N
+    token string
+}
+
+// find returns the position of the edge from -> to in token within
+// g.Edges[from], or -1 if there is none. Edges added or removed without going
+// through g's methods are noticed by the size check and the node's index is
+// rebuilt.
+func (g *GraphOf[N]) find(from, to N, token string) int {
+    edges := g.Edges[from]
+    idx := g.index[from]
+    if len(idx) != len(edges) {
+        idx = g.reindex(from)
+    }
+    i, ok := idx[edgeKey[N]{to, token}]
+    if !ok {
+        return -1
+    }
+    if i >= len(edges) || edges[i].To != to || edges[i].Token != token {
+        // An edge was replaced in place; fall back to the slice itself
+        i, ok = g.reindex(from)[edgeKey[N]{to, token}]
+        if !ok {
+            return -1
+        }
+    }
+    return i
+}
+
+// reindex rebuilds and returns the index of the edges leaving from
+func (g *GraphOf[N]) reindex(from N) map[edgeKey[N]]int {
+    edges := g.Edges[from]
+    if len(edges) == 0 {
+        delete(g.index, from)
+        return nil
+    }
+    if g.index == nil {
+        g.index = make(map[N]map[edgeKey[N]]int)
+    }
+    idx := make(map[edgeKey[N]]int, len(edges))
+    for i, edge := range edges {
+        idx[edgeKey[N]{edge.To, edge.Token}] = i
+    }
+    g.index[from] = idx
+    return idx
+}
+
+// NettingOpOf records one netting step: Amount of Token was offset along
+// every hop of Cycle, including the hop from the last node back to the first
+type NettingOpOf[N comparable] struct {
+    Cycle  []N    `json:"cycle"`
+    Token  string `json:"token"`
+    Amount uint64 `json:"amount"`
+}
+
+// NettingOp is a NettingOpOf with string participant identifiers
+type NettingOp = NettingOpOf[string]
+
+// Hops returns the number of edges the step reduced, which is the number of
+// participants in Cycle since the cycle closes back on its first node
+func (op NettingOpOf[N]) Hops() int {
+    return len(op.Cycle)
+}
+
+func NewGraph() *Graph {
+    return NewGraphOf(cmp.Compare[string])
+}
+
+// NewGraphOf returns an empty graph whose nodes are ordered by compare, which
+// must return a negative number, zero or a positive number as a sorts
+// before, equal to or after b
+func NewGraphOf[N comparable](compare func(a, b N) int) *GraphOf[N] {
+    return &GraphOf[N]{
+        Edges:   make(map[N][]EdgeOf[N]),
+        compare: compare,
+    }
+}
+
+// Add or update edge in the graph. Amounts for an existing edge are
+// accumulated; if the sum would overflow uint64 the edge is left untouched
+// and ErrAmountOverflow is returned. Self-loops are rejected with
+// ErrSelfLoop.
+func (g *GraphOf[N]) AddEdge(from, to N, token string, amount uint64) error {
+    return g.addEdge(from, to, token, amount, nil)
+}
+
+// addEdge is AddEdge that also appends refs to the edge's Refs
+func (g *GraphOf[N]) addEdge(from, to N, token string, amount uint64, refs []string) error {
+    if from == to {
+        return ErrSelfLoop
+    }
+
+    // Check if edge already exists
+    if i := g.find(from, to, token); i >= 0 {
+        edge := &g.Edges[from][i]
+        if edge.Amount > math.MaxUint64-amount {
+            return ErrAmountOverflow
+        }
+        edge.Amount += amount
+        if len(refs) > 0 {
+            edge.Refs = append(edge.Refs, refs...)
+        }
+        g.syncReverse(from, to, token, edge.Amount)
+        return nil
+    }
+    
+    // Add new edge
+    if _, exists := g.Edges[from]; !exists {
+        g.Edges[from] = make([]EdgeOf[N], 0)
+    }
+    edge := EdgeOf[N]{To: to, Token: token, Amount: amount}
+    if len(refs) > 0 {
+        edge.Refs = append([]string(nil), refs...)
+    }
+    g.Edges[from] = append(g.Edges[from], edge)
+    if g.index == nil {
+        g.index = make(map[N]map[edgeKey[N]]int)
+    }
+    if g.index[from] == nil {
+        g.index[from] = make(map[edgeKey[N]]int)
+    }
+    g.index[from][edgeKey[N]{to, token}] = len(g.Edges[from]) - 1
+    g.syncReverse(from, to, token, amount)
+    return nil
+}
+
+// addIntent adds intent to g as addEdge does or, for a reversal, cancels
+// that much of the debt already on its edge, removing the edge if nothing is
+// left. A reversal of more than is owed fails with ErrReversalExceedsDebt and
+// leaves g unchanged.
+func (g *GraphOf[N]) addIntent(intent IntentOf[N]) error {
+    from, to, token := intent.Sender, intent.Receiver, intent.Token
+    if !intent.Reverse {
+        return g.addEdge(from, to, token, intent.Amount, intent.refs())
+    }
+    if from == to {
+        return ErrSelfLoop
+    }
+
+    owed, _ := g.GetEdge(from, to, token)
+    if intent.Amount > owed {
+        return fmt.Errorf("reversing %d of %d owed: %w", intent.Amount, owed, ErrReversalExceedsDebt)
+    }
+    if refs := intent.refs(); len(refs) > 0 && intent.Amount < owed {
+        edge := &g.Edges[from][g.find(from, to, token)]
+        edge.Refs = append(edge.Refs, refs...)
+    }
+    g.subtract(from, to, token, intent.Amount)
+    return nil
+}
+
+// Clone returns a deep copy of g, including its reverse index if enabled.
+// Changes to the copy do not affect g.
+func (g *GraphOf[N]) Clone() *GraphOf[N] {
+    c := NewGraphOf(g.compare)
+    for from, edges := range g.Edges {
+        c.Edges[from] = append([]EdgeOf[N](nil), edges...)
+        for i := range c.Edges[from] {
+            if refs := c.Edges[from][i].Refs; refs != nil {
+                c.Edges[from][i].Refs = append([]string(nil), refs...)
+            }
+        }
+    }
+    if g.reverse != nil {
+        c.reverse = make(map[N][]EdgeOf[N], len(g.reverse))
+        for to, edges := range g.reverse {
+            c.reverse[to] = append([]EdgeOf[N](nil), edges...)
+        }
+    }
+    return c
+}
+
+// Merge adds every edge of other into g as AddEdge would, summing amounts on
+// edges both graphs have. If any sum would overflow, ErrAmountOverflow is
+// returned and g is left unchanged. other is not modified.
+func (g *GraphOf[N]) Merge(other *GraphOf[N]) error {
+    // Check every sum first so a failure leaves g untouched
+    for _, from := range other.sources() {
+        for _, edge := range other.Edges[from] {
+            if have, ok := g.GetEdge(from, edge.To, edge.Token); ok && have > math.MaxUint64-edge.Amount {
+                return fmt.Errorf("edge %v -> %v %s: %w", from, edge.To, edge.Token, ErrAmountOverflow)
+            }
+        }
+    }
+
+    for _, from := range other.sources() {
+        for _, edge := range other.Edges[from] {
+            g.addEdge(from, edge.To, edge.Token, edge.Amount, edge.Refs)
+        }
+    }
+    return nil
+}
+
+// Reset removes every edge from g, keeping the allocated maps so the graph
+// can be refilled without growing them again. A reverse index stays enabled.
+func (g *GraphOf[N]) Reset() {
+    clear(g.Edges)
+    clear(g.index)
+    clear(g.reverse)
+}
+
+// SplitByToken returns a graph per token holding only the edges of g in
+// that token, each node's edges in the order they have in g. The graphs
+// share nothing with g or each other; the reverse index is not carried over.
+func (g *GraphOf[N]) SplitByToken() map[string]*GraphOf[N] {
+    subs := make(map[string]*GraphOf[N])
+    for _, from := range g.sources() {
+        for _, edge := range g.Edges[from] {
+            sub := subs[edge.Token]
+            if sub == nil {
+                sub = NewGraphOf(g.compare)
+                subs[edge.Token] = sub
+            }
+            if edge.Refs != nil {
+                edge.Refs = append([]string(nil), edge.Refs...)
+            }
+            sub.Edges[from] = append(sub.Edges[from], edge)
+        }
+    }
+    return subs
+}
+
+// GetEdge returns the amount owed from -> to in token and whether such an
+// edge exists
+func (g *GraphOf[N]) GetEdge(from, to N, token string) (uint64, bool) {
+    i := g.find(from, to, token)
+    if i < 0 {
+        return 0, false
+    }
+    return g.Edges[from][i].Amount, true
+}
+
+// RemoveEdge deletes the edge from -> to in token and reports whether it
+// existed. The from key is dropped once it has no edges left.
+func (g *GraphOf[N]) RemoveEdge(from, to N, token string) bool {
+    i := g.find(from, to, token)
+    if i < 0 {
+        return false
+    }
+
+    edges := g.Edges[from]
+    if len(edges) == 1 {
+        delete(g.Edges, from)
+        delete(g.index, from)
+    } else {
+        // Keep the remaining edges in order so results stay deterministic;
+        // only the positions after i move
+        g.Edges[from] = append(edges[:i], edges[i+1:]...)
+        idx := g.index[from]
+        delete(idx, edgeKey[N]{to, token})
+        for j := i; j < len(g.Edges[from]); j++ {
+            e := g.Edges[from][j]
+            idx[edgeKey[N]{e.To, e.Token}] = j
+        }
+    }
+    g.dropReverse(from, to, token)
+    return true
+}
+
+// sortNodes orders nodes in place using the graph's comparison
+func (g *GraphOf[N]) sortNodes(nodes []N) {
+    sort.Slice(nodes, func(i, j int) bool {
+        return g.compare(nodes[i], nodes[j]) < 0
+    })
+}
+
+// sources returns the nodes with outgoing edges in sorted order
+func (g *GraphOf[N]) sources() []N {
+    nodes := make([]N, 0, len(g.Edges))
+    for v := range g.Edges {
+        nodes = append(nodes, v)
+    }
+    g.sortNodes(nodes)
+    return nodes
+}
+
+// Nodes returns every participant in g, whether it owes or is owed, in
+// sorted order
+func (g *GraphOf[N]) Nodes() []N {
+    seen := make(map[N]bool, len(g.Edges))
+    nodes := make([]N, 0, len(g.Edges))
+    for from, edges := range g.Edges {
+        if !seen[from] {
+            seen[from] = true
+            nodes = append(nodes, from)
+        }
+        for _, edge := range edges {
+            if !seen[edge.To] {
+                seen[edge.To] = true
+                nodes = append(nodes, edge.To)
+            }
+        }
+    }
+    g.sortNodes(nodes)
+    return nodes
+}
+
+// Tarjan's algorithm for finding SCCs. The depth-first search keeps its own
+// stack of frames rather than recursing, so long chains cannot exhaust the
+// goroutine stack.
+func (g *GraphOf[N]) FindSCCs() [][]N {
+    index := 0
+    stack := make([]N, 0)
+    onStack := make(map[N]bool)
+    indices := make(map[N]int)
+    lowlink := make(map[N]int)
+    sccs := make([][]N, 0)
+
+    // frame is a node being visited and the next of its edges to consider
+    type frame struct {
+        v    N
+        next int
+    }
+    var callStack []frame
+
+    visit := func(v N) {
+        indices[v] = index
+        lowlink[v] = index
+        index++
+        stack = append(stack, v)
+        onStack[v] = true
+        callStack = append(callStack, frame{v: v})
+    }
+
+    strongConnect := func(root N) {
+        visit(root)
+        for len(callStack) > 0 {
+            top := &callStack[len(callStack)-1]
+            v := top.v
+
+            // Consider successors
+            if top.next < len(g.Edges[v]) {
+                w := g.Edges[v][top.next].To
+                top.next++
+                if _, exists := indices[w]; !exists {
+                    // Successor not yet visited; lowlink[v] is updated
+                    // when w's frame is popped
+                    visit(w)
+                } else if onStack[w] {
+                    // Successor is on stack and hence in current SCC
+                    lowlink[v] = int(math.Min(float64(lowlink[v]), float64(indices[w])))
+                }
+                continue
+            }
+
+            // All successors done; return to the caller
+            callStack = callStack[:len(callStack)-1]
+            if len(callStack) > 0 {
+                u := callStack[len(callStack)-1].v
+                lowlink[u] = int(math.Min(float64(lowlink[u]), float64(lowlink[v])))
+            }
+
+            // If v is a root node, pop the stack and generate an SCC
+            if lowlink[v] == indices[v] {
+                scc := make([]N, 0)
+                for {
+                    w := stack[len(stack)-1]
+                    stack = stack[:len(stack)-1]
+                    onStack[w] = false
+                    scc = append(scc, w)
+                    if w == v {
+                        break
+                    }
+                }
+                if len(scc) > 1 { // Only interested in SCCs with size > 1
+                    sccs = append(sccs, scc)
+                }
+            }
+        }
+    }
+
+    // Find SCCs, starting from nodes in sorted order so results are
+    // reproducible
+    for _, v := range g.sources() {
+        if _, exists := indices[v]; !exists {
+            strongConnect(v)
+        }
+    }
+
+    return sccs
+}
+
+// canonicalCycle returns a copy of cycle rotated so that its smallest node
+// comes first
+func (g *GraphOf[N]) canonicalCycle(cycle []N) []N {
+    start := 0
+    for i, v := range cycle {
+        if g.compare(v, cycle[start]) < 0 {
+            start = i
+        }
+    }
+    canonical := make([]N, 0, len(cycle))
+    canonical = append(canonical, cycle[start:]...)
+    return append(canonical, cycle[:start]...)
+}
+
+// Find cycles in a strongly connected component. Each cycle is reported once,
+// rotated so that its smallest node comes first. Cycles have between 2 and
+// maxLength distinct nodes.
+//
+// When maxLength is at least len(g.Edges), the number of nodes that owe
+// anything, no cycle can be too long and the search blocks fruitless nodes
+// as Johnson's algorithm does, taking time roughly linear in the cycles
+// found. With the usual short limits it is a plain depth-limited search,
+// which may walk the same dead ends again from every start node and grows
+// exponentially with maxLength on dense SCCs.
+func (g *GraphOf[N]) FindCycles(scc []N, maxLength int) [][]N {
+    cycles, _ := g.findCycles(context.Background(), scc, maxLength, 0)
+    return cycles
+}
+
+// AllCycles returns the cycles of up to maxLength nodes anywhere in g, SCC by
+// SCC. Every cycle lies within one SCC, so each is reported exactly once.
+func (g *GraphOf[N]) AllCycles(maxLength int) [][]N {
+    cycles := make([][]N, 0)
+    for _, scc := range g.FindSCCs() {
+        cycles = append(cycles, g.FindCycles(scc, maxLength)...)
+    }
+    return cycles
+}
+
+// SCCReportOf describes one strongly connected component and the cycles of
+// up to a given length within it
+type SCCReportOf[N comparable] struct {
+    Members []N   `json:"members"`
+    Cycles  [][]N `json:"cycles"`
+}
+
+// SCCReport is an SCCReportOf with string participant identifiers
+type SCCReport = SCCReportOf[string]
+
+// Analyze returns a report for every SCC of g with more than one node, in
+// FindSCCs order, listing its members in sorted order and its cycles of up
+// to maxLength nodes as FindCycles finds them
+func (g *GraphOf[N]) Analyze(maxLength int) []SCCReportOf[N] {
+    reports := make([]SCCReportOf[N], 0)
+    for _, scc := range g.FindSCCs() {
+        members := append([]N(nil), scc...)
+        g.sortNodes(members)
+        reports = append(reports, SCCReportOf[N]{Members: members, Cycles: g.FindCycles(scc, maxLength)})
+    }
+    return reports
+}
+
+// LargestNettableCycle returns the cycle of up to maxLength nodes that nets
+// the most of token, along with that amount. Ties go to the cycle AllCycles
+// reports first. The bool is false if no cycle can net anything. The graph
+// is not changed; pass the result to ApplyNetting to settle it.
+func (g *GraphOf[N]) LargestNettableCycle(token string, maxLength int) ([]N, uint64, bool) {
+    var best []N
+    var bestAmount uint64
+    for _, cycle := range g.AllCycles(maxLength) {
+        amount, ok := g.CalculateNetting(cycle, token)
+        if ok && amount > bestAmount {
+            best, bestAmount = cycle, amount
+        }
+    }
+    return best, bestAmount, best != nil
+}
+
+// ctxCheckInterval is how many search steps pass between checks for
+// cancellation in the hot loops
+const ctxCheckInterval = 1024
+
+// Cycles calls yield with each cycle of up to maxLength nodes in scc, in the
+// order and form FindCycles returns them, stopping early once yield returns
+// false. Cycles are passed on as the search reaches them and none is kept,
+// so the whole set never needs to fit in memory. The slice passed to yield
+// is its own to keep.
+func (g *GraphOf[N]) Cycles(scc []N, maxLength int, yield func([]N) bool) {
+    g.eachCycle(context.Background(), scc, maxLength, yield)
+}
+
+// findCycles is FindCycles that gives up with ctx.Err() once ctx is done. If
+// maxCycles is positive the search stops as soon as that many cycles have
+// been found.
+func (g *GraphOf[N]) findCycles(ctx context.Context, scc []N, maxLength, maxCycles int) ([][]N, error) {
+    cycles := make([][]N, 0)
+    err := g.eachCycle(ctx, scc, maxLength, func(cycle []N) bool {
+        cycles = append(cycles, cycle)
+        return maxCycles <= 0 || len(cycles) < maxCycles
+    })
+    if err != nil {
+        return nil, err
+    }
+    return cycles, nil
+}
+
+// eachCycle is Cycles that gives up with ctx.Err() once ctx is done
+func (g *GraphOf[N]) eachCycle(ctx context.Context, scc []N, maxLength int, yield func([]N) bool) error {
+    // A cycle is only searched for from the first of its nodes in scc, so
+    // the search from start never enters a node earlier in scc and each
+    // cycle is reached once without remembering those already found
+    rank := make(map[N]int, len(scc))
+    for i, v := range scc {
+        rank[v] = i
+    }
+
+    // Parallel edges in different tokens lead to the same cycles, so only
+    // distinct successors are followed, in the order their edges were added
+    successors := make(map[N][]N)
+    distinct := func(v N) []N {
+        next, ok := successors[v]
+        if !ok {
+            added := make(map[N]bool, len(g.Edges[v]))
+            next = make([]N, 0, len(g.Edges[v]))
+            for _, edge := range g.Edges[v] {
+                if !added[edge.To] {
+                    added[edge.To] = true
+                    next = append(next, edge.To)
+                }
+            }
+            successors[v] = next
+        }
+        return next
+    }
+
+    var visited map[N]bool
+    var path []N
+    steps := 0
+    var err error
+    done := false
+
+    // Every node on a cycle has an edge out, so when maxLength is at least
+    // the number of such nodes it never cuts a path short. The search can
+    // then block nodes as Johnson's algorithm does: one from which start
+    // could not be reached stays blocked until a node it leads to reaches
+    // start, so fruitless branches are not explored again and again.
+    // Blocking only prunes branches that find nothing, so the cycles still
+    // come in the same order.
+    johnson := maxLength >= len(g.Edges)
+    var blockedBy map[N][]N
+    var unblock func(v N)
+    unblock = func(v N) {
+        visited[v] = false
+        waiting := blockedBy[v]
+        delete(blockedBy, v)
+        for _, w := range waiting {
+            if visited[w] {
+                unblock(w)
+            }
+        }
+    }
+
+    // The path holds distinct nodes only: start is never re-entered, a
+    // cycle is reported when an edge leads back to it, and the path is not
+    // extended beyond maxLength nodes. It reports whether any cycle was
+    // reached from current.
+    var findCyclesRecursive func(current N, start N) bool
+    findCyclesRecursive = func(current N, start N) bool {
+        visited[current] = true
+        path = append(path, current)
+        found := false
+
+        for _, to := range distinct(current) {
+            // Every edge is a step, as on a dense SCC most of the work is
+            // closing cycles rather than descending
+            steps++
+            if steps%ctxCheckInterval == 0 {
+                err = ctx.Err()
+            }
+            if err != nil || done {
+                break
+            }
+            if to == start {
+                // A self-loop is not a cycle worth netting
+                if len(path) >= 2 {
+                    found = true
+                    if !yield(g.canonicalCycle(path)) {
+                        done = true
+                    }
+                }
+                continue
+            }
+            if r, ok := rank[to]; ok && r < rank[start] {
+                continue
+            }
+            if !visited[to] && len(path) < maxLength && findCyclesRecursive(to, start) {
+                found = true
+            }
+        }
+
+        path = path[:len(path)-1]
+        switch {
+        case !johnson:
+            visited[current] = false
+        case found:
+            unblock(current)
+        default:
+            // Stay blocked until a successor is found to reach start
+            for _, to := range distinct(current) {
+                if !slices.Contains(blockedBy[to], current) {
+                    blockedBy[to] = append(blockedBy[to], current)
+                }
+            }
+        }
+        return found
+    }
+
+    // Start DFS from each vertex, each with its own visitation state so no
+    // root's search can block another's
+    for _, v := range scc {
+        visited = make(map[N]bool)
+        blockedBy = make(map[N][]N)
+        path = make([]N, 0, min(maxLength, len(g.Edges)))
+        findCyclesRecursive(v, v)
+        if err != nil {
+            return err
+        }
+        if done {
+            break
+        }
+    }
+    return nil
+}
+
+// Calculate netting amount for a cycle. The bool is false if some hop in
+// the cycle has no edge for token, in which case nothing can be netted.
+// Every hop sharing the minimum is zeroed by ApplyNetting, so ties need no
+// breaking: no one edge is picked to break the cycle.
+func (g *GraphOf[N]) CalculateNetting(cycle []N, token string) (uint64, bool) {
+    return g.CalculateNettingRetaining(cycle, token, nil)
+}
+
+// ApplyNetting subtracts amount from every edge in the cycle. Edges that
+// reach zero are removed from the graph. All hops are checked first, so if
+// any edge is missing or smaller than amount the graph is left unchanged and
+// an error is returned.
+func (g *GraphOf[N]) ApplyNetting(cycle []N, token string, amount uint64) error {
+    // A hop listed more than once is reduced once per listing
+    need := make(map[EdgeKeyOf[N]]uint64, len(cycle))
+    for i := 0; i < len(cycle); i++ {
+        from := cycle[i]
+        to := cycle[(i+1)%len(cycle)]
+
+        have, ok := g.GetEdge(from, to, token)
+        if !ok {
+            return fmt.Errorf("no %s edge %v -> %v", token, from, to)
+        }
+        key := EdgeKeyOf[N]{From: from, To: to, Token: token}
+        if need[key] > have || amount > have-need[key] {
+            return fmt.Errorf("%s edge %v -> %v holds %d, cannot net %d", token, from, to, have, amount)
+        }
+        need[key] += amount
+    }
+
+    // Subtract netting amount from each edge in cycle
+    for i := 0; i < len(cycle); i++ {
+        from := cycle[i]
+        to := cycle[(i+1)%len(cycle)]
+        
+        g.subtract(from, to, token, amount)
+    }
+    return nil
+}
+
+// ApplyNettingBatch applies every step in ops as ApplyNetting would, as one
+// transaction. The steps are checked together against g first, so if any
+// hop is missing or would be reduced below zero by the steps before it, g is
+// left unchanged and an error naming the first such step is returned.
+func (g *GraphOf[N]) ApplyNettingBatch(ops []NettingOpOf[N]) error {
+    need := make(map[EdgeKeyOf[N]]uint64)
+    for i, op := range ops {
+        for j := 0; j < len(op.Cycle); j++ {
+            from := op.Cycle[j]
+            to := op.Cycle[(j+1)%len(op.Cycle)]
+
+            have, ok := g.GetEdge(from, to, op.Token)
+            if !ok {
+                return fmt.Errorf("op %d: no %s edge %v -> %v", i, op.Token, from, to)
+            }
+            key := EdgeKeyOf[N]{From: from, To: to, Token: op.Token}
+            if need[key] > have || op.Amount > have-need[key] {
+                return fmt.Errorf("op %d: %s edge %v -> %v holds %d, cannot net %d after %d", i, op.Token, from, to, have, op.Amount, need[key])
+            }
+            need[key] += op.Amount
+        }
+    }
+
+    for _, op := range ops {
+        for j := 0; j < len(op.Cycle); j++ {
+            g.subtract(op.Cycle[j], op.Cycle[(j+1)%len(op.Cycle)], op.Token, op.Amount)
+        }
+    }
+    return nil
+}
+
+// subtract lowers the edge from -> to in token by amount, removing it if it
+// reaches zero
+func (g *GraphOf[N]) subtract(from, to N, token string, amount uint64) {
+    i := g.find(from, to, token)
+    if i < 0 {
+        return
+    }
+    edge := &g.Edges[from][i]
+    edge.Amount -= amount
+    if edge.Amount == 0 {
+        g.RemoveEdge(from, to, token)
+    } else {
+        g.syncReverse(from, to, token, edge.Amount)
+    }
+}
+
+// sortIntents orders intents by sender, then receiver, then token
+func sortIntents[N comparable](intents []IntentOf[N], compare func(a, b N) int) {
+    sort.Slice(intents, func(i, j int) bool {
+        a, b := intents[i], intents[j]
+        if c := compare(a.Sender, b.Sender); c != 0 {
+            return c < 0
+        }
+        if c := compare(a.Receiver, b.Receiver); c != 0 {
+            return c < 0
+        }
+        return a.Token < b.Token
+    })
+}
+
+// ToIntents returns the remaining debts, sorted by sender, receiver and token
+func (g *GraphOf[N]) ToIntents() []IntentOf[N] {
+    intents := make([]IntentOf[N], 0)
+    
+    for from, edges := range g.Edges {
+        for _, edge := range edges {
+            if edge.Amount > 0 {
+                intents = append(intents, IntentOf[N]{
+                    Sender:    from,
+                    Receiver:  edge.To,
+                    Token:     edge.Token,
+                    Amount:    edge.Amount,
+                    Refs:      append([]string(nil), edge.Refs...),
+                })
+            }
+        }
+    }
+
+    sortIntents(intents, g.compare)
+    return intents
+}
+
+// NewIntent returns the intent for amount of token owed by sender to
+// receiver, or an error if a field is empty, amount is zero or sender and
+// receiver are the same, in which case ErrSelfLoop is returned
+func NewIntent(sender, receiver, token string, amount uint64) (Intent, error) {
+    intent := Intent{Sender: sender, Receiver: receiver, Token: token, Amount: amount}
+    if err := validateIntent(intent); err != nil {
+        return Intent{}, err
+    }
+    if sender == receiver {
+        return Intent{}, ErrSelfLoop
+    }
+    return intent, nil
+}
+
+// validateIntent checks that an intent names both participants, a token and
+// a nonzero amount. Self-loops pass; callers drop them.
+func validateIntent[N comparable](intent IntentOf[N]) error {
+    var none N
+    switch {
+    case intent.Sender == none:
+        return errors.New("empty sender")
+    case intent.Receiver == none:
+        return errors.New("empty receiver")
+    case intent.Token == "":
+        return errors.New("empty token")
+    case intent.Amount == 0:
+        return errors.New("zero amount")
+    }
+    return nil
+}
+
+// ProcessNetting nets intents with the default Options. The result is never
+// nil; an empty or nil batch gives an empty slice.
+func ProcessNetting(intents []Intent) ([]Intent, error) {
+    return ProcessNettingWithOptions(intents, Options{})
+}
+
+// ProcessNettingWithOptions nets intents, offsetting debts along cycles of
+// the debt graph, and returns the remaining intents. The result depends only
+// on intents and opts: components and nodes are visited in sorted order and
+// each node's edges in the order first added, so repeated runs give
+// identical output.
+func ProcessNettingWithOptions(intents []Intent, opts Options) ([]Intent, error) {
+    return processNetting(context.Background(), intents, opts)
+}
+
+// ProcessNettingWithOps is ProcessNettingWithOptions that also returns every
+// netting step applied, in order
+func ProcessNettingWithOps(intents []Intent, opts Options) ([]Intent, []NettingOp, error) {
+    opts, err := opts.withDefaults()
+    if err != nil {
+        return nil, nil, err
+    }
+
+    intents, _, err = opts.live(intents)
+    if err != nil {
+        return nil, nil, err
+    }
+    g, _, err := buildGraph(intents)
+    if err != nil {
+        return nil, nil, err
+    }
+    ops, _, err := g.netCycles(context.Background(), opts)
+    if err != nil {
+        return nil, nil, err
+    }
+    return g.residuals(intents, opts), ops, nil
+}
+
+// ProcessNettingContext is ProcessNetting that stops early with ctx.Err()
+// once ctx is done. Netting works on its own graph, so on cancellation no
+// partial result is returned and intents are left untouched.
+func ProcessNettingContext(ctx context.Context, intents []Intent) ([]Intent, error) {
+    return processNetting(ctx, intents, Options{})
+}
+
+// NetToken nets only the intents in token with the default Options and
+// returns what remains of them. Intents in other tokens are dropped, not
+// passed through, and are not validated. ProcessNetting nets each token on
+// its own too, so the result is the token's share of ProcessNetting on the
+// whole batch.
+func NetToken(intents []Intent, token string) ([]Intent, error) {
+    selected := make([]Intent, 0)
+    for _, intent := range intents {
+        if intent.Token == token {
+            selected = append(selected, intent)
+        }
+    }
+    return ProcessNetting(selected)
+}
+
+// ProcessNettingOf is ProcessNettingWithOptions for participants identified
+// by N, ordered by compare
+func ProcessNettingOf[N comparable](intents []IntentOf[N], compare func(a, b N) int, opts OptionsOf[N]) ([]IntentOf[N], error) {
+    return processNettingOf(context.Background(), intents, compare, opts)
+}
+
+func processNetting(ctx context.Context, intents []Intent, opts Options) ([]Intent, error) {
+    return processNettingOf(ctx, intents, cmp.Compare[string], opts)
+}
+
+func processNettingOf[N comparable](ctx context.Context, intents []IntentOf[N], compare func(a, b N) int, opts OptionsOf[N]) ([]IntentOf[N], error) {
+    opts, err := opts.withDefaults()
+    if err != nil {
+        return nil, err
+    }
+    intents, _, err = opts.live(intents)
+    if err != nil {
+        return nil, err
+    }
+    if len(intents) == 0 {
+        return []IntentOf[N]{}, nil
+    }
+
+    g, _, err := buildGraphOf(intents, compare)
+    if err != nil {
+        return nil, err
+    }
+    if _, _, err := g.netCycles(ctx, opts); err != nil {
+        return nil, err
+    }
+
+    // Convert back to intents
+    return g.residuals(intents, opts), nil
+}
+
+// buildGraph validates intents and accumulates them into a new graph, in
+// order, so a reversal cancels debt from the intents before it. Self-loops
+// are dropped rather than added, and their number is returned.
+func buildGraph(intents []Intent) (*Graph, int, error) {
+    return buildGraphOf(intents, cmp.Compare[string])
+}
+
+// buildGraphOf is buildGraph for participants identified by N
+func buildGraphOf[N comparable](intents []IntentOf[N], compare func(a, b N) int) (*GraphOf[N], int, error) {
+    // Validate input before touching the graph
+    for i, intent := range intents {
+        if err := validateIntent(intent); err != nil {
+            return nil, 0, fmt.Errorf("intent %d: %w", i, err)
+        }
+    }
+
+    g := NewGraphOf(compare)
+    selfLoops := 0
+    for i, intent := range intents {
+        if intent.Sender == intent.Receiver {
+            selfLoops++
+            continue
+        }
+        if err := g.addIntent(intent); err != nil {
+            return nil, 0, fmt.Errorf("intent %d: %w", i, err)
+        }
+    }
+    return g, selfLoops, nil
+}
+
+// netCycles offsets debts along every cycle found within the SCCs of g and
+// returns the steps applied, and whether opts.Budget or a cycle cap cut
+// netting short. If ctx is done it stops with ctx.Err(), leaving g partially
+// netted and returning the steps applied so far. Running out of time within
+// the budget is not an error, but a debt left over its credit limit is.
+func (g *GraphOf[N]) netCycles(ctx context.Context, opts OptionsOf[N]) ([]NettingOpOf[N], bool, error) {
+    if opts.Budget.Time <= 0 {
+        ops, truncated, err := g.netAll(ctx, opts)
+        return ops, truncated, g.withinLimits(opts, err)
+    }
+
+    budget, cancel := context.WithTimeout(ctx, opts.Budget.Time)
+    defer cancel()
+    ops, truncated, err := g.netAll(budget, opts)
+    if err != nil && ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+        return ops, true, g.withinLimits(opts, nil)
+    }
+    return ops, truncated, g.withinLimits(opts, err)
+}
+
+// withinLimits returns err, or if it is nil an error wrapping ErrCreditLimit
+// if a debt of g is over its opts.CreditLimits entry
+func (g *GraphOf[N]) withinLimits(opts OptionsOf[N], err error) error {
+    if err != nil || len(opts.CreditLimits) == 0 {
+        return err
+    }
+    return g.CheckCreditLimits(opts.CreditLimits)
+}
+
+// netAll is netCycles without the time budget
+func (g *GraphOf[N]) netAll(ctx context.Context, opts OptionsOf[N]) ([]NettingOpOf[N], bool, error) {
+    // Tokens never net against each other, so each is netted on its own and
+    // the result is the same whatever else the batch holds
+    if opts.Workers > 1 || g.mixesTokens() {
+        return g.netByToken(ctx, opts)
+    }
+
+    // Mutual debts cancel without any cycle search
+    ops := g.netBilateral(opts)
+
+    // Arguments are only built when there is somewhere to send them
+    log := opts.Logger
+    if log != nil {
+        for _, op := range ops {
+            log.Printf("netting: bilateral %v netted %d %s", op.Cycle, op.Amount, op.Token)
+        }
+    }
+    if opts.OnNetting != nil {
+        for _, op := range ops {
+            opts.OnNetting(op)
+        }
+    }
+
+    if opts.ShortestCycles {
+        rest, err := g.netShortest(ctx, opts)
+        return append(ops, rest...), false, err
+    }
+
+    // Find SCCs
+    sccs := g.FindSCCs()
+    if log != nil {
+        log.Printf("netting: found %d SCCs", len(sccs))
+    }
+
+    limit := opts.MaxCycles
+    if opts.Budget.Memory > 0 {
+        if n := opts.Budget.cycles(opts.MaxCycleLength, cycleSize[N]()); limit == 0 || n < limit {
+            limit = n
+        }
+    }
+
+    // Process each SCC
+    truncated := false
+    for _, scc := range sccs {
+        if err := ctx.Err(); err != nil {
+            return ops, truncated, err
+        }
+        if !opts.searches(scc) {
+            continue
+        }
+        if opts.OnSCCFound != nil {
+            opts.OnSCCFound(append([]N(nil), scc...))
+        }
+
+        // Enumerating a dense SCC can take factorially long, so with nothing
+        // capping the search it is settled on net positions instead
+        if limit == 0 && opts.CycleFilter == nil && g.tooDense(scc, opts.MaxCycleLength) {
+            opts.warnDense(scc)
+            rest, err := g.netDense(ctx, opts, scc)
+            ops = append(ops, rest...)
+            if err != nil {
+                return ops, truncated, err
+            }
+            continue
+        }
+
+        // Find cycles
+        cycles, err := g.findCycles(ctx, scc, opts.MaxCycleLength, limit)
+        if err != nil {
+            return ops, truncated, err
+        }
+        if limit > 0 && len(cycles) >= limit {
+            truncated = true
+        }
+        if log != nil {
+            log.Printf("netting: SCC %v has %d cycles", scc, len(cycles))
+            for _, cycle := range cycles {
+                log.Printf("netting: cycle %v", cycle)
+            }
+        }
+        if opts.OnCycleFound != nil {
+            for _, cycle := range cycles {
+                opts.OnCycleFound(append([]N(nil), cycle...))
+            }
+        }
+        if opts.MaxParticipants > 0 {
+            // Cycles never repeat a node, so their length is the number of
+            // participants
+            kept := cycles[:0]
+            for _, cycle := range cycles {
+                if len(cycle) <= opts.MaxParticipants {
+                    kept = append(kept, cycle)
+                } else if log != nil {
+                    log.Printf("netting: cycle %v skipped, over %d participants", cycle, opts.MaxParticipants)
+                }
+            }
+            cycles = kept
+        }
+
+        candidates := g.candidates(cycles, opts)
+        orderCandidates(candidates, opts.CycleOrder)
+        opts.prioritize(candidates)
+
+        if opts.Fairness {
+            if opts.CycleFilter != nil {
+                kept := candidates[:0]
+                for _, c := range candidates {
+                    if opts.takes(c.cycle, c.token, c.amount) {
+                        kept = append(kept, c)
+                    }
+                }
+                candidates = kept
+            }
+            fair, err := g.netFairly(ctx, candidates, opts)
+            ops = append(ops, fair...)
+            if err != nil {
+                return ops, truncated, err
+            }
+            continue
+        }
+
+        // Net each candidate; earlier ones may have reduced its edges, so
+        // the amount is recomputed
+        for i, c := range candidates {
+            if i%ctxCheckInterval == 0 {
+                if err := ctx.Err(); err != nil {
+                    return ops, truncated, err
+                }
+            }
+
+            amount, ok := g.CalculateNettingRetaining(c.cycle, c.token, opts.MinRetain)
+            if ok && opts.takes(c.cycle, c.token, amount) {
+                if err := g.ApplyNetting(c.cycle, c.token, amount); err != nil {
+                    return ops, truncated, err
+                }
+                op := NettingOpOf[N]{
+                    Cycle:  append([]N(nil), c.cycle...),
+                    Token:  c.token,
+                    Amount: amount,
+                }
+                opts.applied(op)
+                ops = append(ops, op)
+            }
+        }
+    }
+    return ops, truncated, nil
+}
+
+// PreviewNetting returns what netting g with opts would leave and the steps
+// it would take, without changing g. The work is done on a Clone, so g is
+// left exactly as it was.
+func (g *GraphOf[N]) PreviewNetting(opts OptionsOf[N]) ([]IntentOf[N], []NettingOpOf[N], error) {
+    opts, err := opts.withDefaults()
+    if err != nil {
+        return nil, nil, err
+    }
+    c := g.Clone()
+    ops, _, err := c.netCycles(context.Background(), opts)
+    if err != nil {
+        return nil, nil, err
+    }
+    return c.ToIntents(), ops, nil
+}
+
+// NetBilateral offsets mutual debts in one pass: wherever a owes b and b owes
+// a in the same token, both edges are lowered by the smaller amount, so at
+// most one direction remains. It returns the steps applied as 2-cycles.
+func (g *GraphOf[N]) NetBilateral() []NettingOpOf[N] {
+    return g.netBilateral(OptionsOf[N]{})
+}
+
+// netBilateral is NetBilateral restricted to the tokens opts nets and
+// respecting its MinRetain floors
+func (g *GraphOf[N]) netBilateral(opts OptionsOf[N]) []NettingOpOf[N] {
+    // Collect pairs first, as netting removes edges
+    var pairs []NettingOpOf[N]
+    for _, from := range g.sources() {
+        for _, edge := range g.Edges[from] {
+            // Visit each pair once, from its smaller node
+            if g.compare(from, edge.To) > 0 || !opts.nets(edge.Token) || opts.forbidden[[2]N{from, edge.To}] {
+                continue
+            }
+            if _, ok := g.GetEdge(edge.To, from, edge.Token); ok {
+                amount, _ := g.CalculateNettingRetaining([]N{from, edge.To}, edge.Token, opts.MinRetain)
+                if opts.takes([]N{from, edge.To}, edge.Token, amount) {
+                    pairs = append(pairs, NettingOpOf[N]{Cycle: []N{from, edge.To}, Token: edge.Token, Amount: amount})
+                }
+            }
+        }
+    }
+
+    // Pairs are disjoint and within their edges' amounts, so this cannot fail
+    for _, op := range pairs {
+        g.ApplyNetting(op.Cycle, op.Token, op.Amount)
+    }
+    return pairs
+}
+
+// candidate is a cycle that can be netted in a single token
+type candidate[N comparable] struct {
+    cycle  []N
+    token  string
+    amount uint64
+}
+
+// candidates returns, for each cycle in order, one candidate per token that
+// is present on every hop, in token order
+func (g *GraphOf[N]) candidates(cycles [][]N, opts OptionsOf[N]) []candidate[N] {
+    candidates := make([]candidate[N], 0, len(cycles))
+    for _, cycle := range cycles {
+        if !opts.allows(cycle) {
+            continue
+        }
+
+        // Any token nettable around the cycle must be on its first hop
+        tokens := make([]string, 0)
+        for _, edge := range g.Edges[cycle[0]] {
+            if edge.To == cycle[1%len(cycle)] && opts.nets(edge.Token) {
+                tokens = append(tokens, edge.Token)
+            }
+        }
+        sort.Strings(tokens)
+
+        for _, token := range tokens {
+            if amount, ok := g.CalculateNettingRetaining(cycle, token, opts.MinRetain); ok && opts.worth(amount) {
+                candidates = append(candidates, candidate[N]{cycle: cycle, token: token, amount: amount})
+            }
+        }
+    }
+    return candidates
+}
+
+// orderCandidates sorts candidates in place according to order. Ties keep
+// discovery order.
+func orderCandidates[N comparable](candidates []candidate[N], order CycleOrder) {
+    switch order {
+    case ByAmountDesc:
+        sort.SliceStable(candidates, func(i, j int) bool {
+            return candidates[i].amount > candidates[j].amount
+        })
+    case ByLength:
+        sort.SliceStable(candidates, func(i, j int) bool {
+            return len(candidates[i].cycle) < len(candidates[j].cycle)
+        })
+    }
+}
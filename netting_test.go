@@ -0,0 +1,1066 @@
+package netting
+
+import (
+    "bytes"
+    "context"
+    "errors"
+    "fmt"
+    "log"
+    "math"
+    "math/rand"
+    "reflect"
+    "slices"
+    "sort"
+    "strings"
+    "testing"
+)
+
+// randomIntents returns count intents between nodes participants in tokens
+// tokens, with amounts up to 100
+func randomIntents(r *rand.Rand, nodes, tokens, count int) []Intent {
+    intents := make([]Intent, count)
+    for i := range intents {
+        sender := r.Intn(nodes)
+        receiver := (sender + 1 + r.Intn(nodes-1)) % nodes
+        intents[i] = Intent{
+            Sender:   fmt.Sprintf("n%d", sender),
+            Receiver: fmt.Sprintf("n%d", receiver),
+            Token:    fmt.Sprintf("t%d", r.Intn(tokens)),
+            Amount:   uint64(1 + r.Intn(100)),
+        }
+    }
+    return intents
+}
+
+func TestAddEdgeOverflow(t *testing.T) {
+    g := NewGraph()
+    if err := g.AddEdge("A", "B", "T", math.MaxUint64-1); err != nil {
+        t.Fatal(err)
+    }
+    if err := g.AddEdge("A", "B", "T", 2); !errors.Is(err, ErrAmountOverflow) {
+        t.Fatalf("AddEdge error = %v, want ErrAmountOverflow", err)
+    }
+    if amount := g.Edges["A"][0].Amount; amount != math.MaxUint64-1 {
+        t.Errorf("edge = %d after rejected add, want %d", amount, uint64(math.MaxUint64-1))
+    }
+
+    _, err := ProcessNetting([]Intent{
+        {Sender: "A", Receiver: "B", Token: "T", Amount: math.MaxUint64},
+        {Sender: "A", Receiver: "B", Token: "T", Amount: 1},
+    })
+    if !errors.Is(err, ErrAmountOverflow) {
+        t.Errorf("ProcessNetting error = %v, want ErrAmountOverflow", err)
+    }
+}
+
+func TestProcessNettingDeterministic(t *testing.T) {
+    intents := randomIntents(rand.New(rand.NewSource(1)), 12, 3, 80)
+    want, err := ProcessNetting(intents)
+    if err != nil {
+        t.Fatal(err)
+    }
+    for i := 0; i < 50; i++ {
+        got, err := ProcessNetting(intents)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if !reflect.DeepEqual(got, want) {
+            t.Fatalf("run %d differs:\n%v\nwant\n%v", i, got, want)
+        }
+    }
+}
+
+// triangle returns the balanced cycle A -> B -> C -> A of amount in token
+func triangle(token string, amount uint64) []Intent {
+    return []Intent{
+        {Sender: "A", Receiver: "B", Token: token, Amount: amount},
+        {Sender: "B", Receiver: "C", Token: token, Amount: amount},
+        {Sender: "C", Receiver: "A", Token: token, Amount: amount},
+    }
+}
+
+func TestFindCyclesTriangleOnce(t *testing.T) {
+    g, _, err := buildGraph(triangle("T", 5))
+    if err != nil {
+        t.Fatal(err)
+    }
+    var cycles [][]string
+    for _, scc := range g.FindSCCs() {
+        cycles = append(cycles, g.FindCycles(scc, DefaultMaxCycleLength)...)
+    }
+    if want := [][]string{{"A", "B", "C"}}; !reflect.DeepEqual(cycles, want) {
+        t.Fatalf("cycles = %v, want %v", cycles, want)
+    }
+
+    // The triangle nets in one step rather than one per rotation
+    out, ops, err := ProcessNettingWithOps(triangle("T", 5), Options{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(out) != 0 {
+        t.Errorf("residual = %v, want none", out)
+    }
+    if len(ops) != 1 {
+        t.Errorf("ops = %v, want one step", ops)
+    }
+}
+
+func TestCalculateNettingMissingToken(t *testing.T) {
+    // The cycle closes only across two tokens, so neither can net
+    intents := []Intent{
+        {Sender: "A", Receiver: "B", Token: "X", Amount: 5},
+        {Sender: "B", Receiver: "C", Token: "X", Amount: 5},
+        {Sender: "C", Receiver: "A", Token: "Y", Amount: 5},
+    }
+    g, _, err := buildGraph(intents)
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, token := range []string{"X", "Y"} {
+        if amount, ok := g.CalculateNetting([]string{"A", "B", "C"}, token); ok || amount != 0 {
+            t.Errorf("CalculateNetting(%s) = %d, %v, want 0, false", token, amount, ok)
+        }
+    }
+
+    out, err := ProcessNetting(intents)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !IntentsEqual(out, intents) {
+        t.Errorf("ProcessNetting = %v, want input unchanged", out)
+    }
+}
+
+func TestFindSCCsLongChain(t *testing.T) {
+    const n = 100000
+    g := NewGraph()
+    for i := 0; i < n-1; i++ {
+        if err := g.AddEdge(fmt.Sprint(i), fmt.Sprint(i+1), "T", 1); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if err := g.AddEdge(fmt.Sprint(n-1), "0", "T", 1); err != nil {
+        t.Fatal(err)
+    }
+
+    sccs := g.FindSCCs()
+    if len(sccs) != 1 || len(sccs[0]) != n {
+        t.Fatalf("got %d SCCs, want one of %d nodes", len(sccs), n)
+    }
+}
+
+func TestApplyNettingPrunesZeroEdges(t *testing.T) {
+    g, _, err := buildGraph(append(triangle("T", 5), Intent{Sender: "A", Receiver: "B", Token: "U", Amount: 1}))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := g.ApplyNetting([]string{"A", "B", "C"}, "T", 5); err != nil {
+        t.Fatal(err)
+    }
+    for from, edges := range g.Edges {
+        for _, edge := range edges {
+            if edge.Token == "T" {
+                t.Errorf("edge %s -> %s %d left in T", from, edge.To, edge.Amount)
+            }
+        }
+    }
+    if len(g.Edges) != 1 || len(g.Edges["A"]) != 1 {
+        t.Errorf("Edges = %v, want only A's U edge", g.Edges)
+    }
+}
+
+// allCycles returns the cycles FindCycles finds in every SCC of intents
+func allCycles(t *testing.T, intents []Intent, maxLength int) [][]string {
+    t.Helper()
+    g, _, err := buildGraph(intents)
+    if err != nil {
+        t.Fatal(err)
+    }
+    var cycles [][]string
+    for _, scc := range g.FindSCCs() {
+        cycles = append(cycles, g.FindCycles(scc, maxLength)...)
+    }
+    sort.Slice(cycles, func(i, j int) bool {
+        return fmt.Sprint(cycles[i]) < fmt.Sprint(cycles[j])
+    })
+    return cycles
+}
+
+func TestFindCyclesOverlapping(t *testing.T) {
+    // Both cycles use A -> B
+    intents := []Intent{
+        {Sender: "A", Receiver: "B", Token: "T", Amount: 10},
+        {Sender: "B", Receiver: "C", Token: "T", Amount: 4},
+        {Sender: "C", Receiver: "A", Token: "T", Amount: 4},
+        {Sender: "B", Receiver: "D", Token: "T", Amount: 6},
+        {Sender: "D", Receiver: "A", Token: "T", Amount: 6},
+    }
+    want := [][]string{{"A", "B", "C"}, {"A", "B", "D"}}
+    if got := allCycles(t, intents, DefaultMaxCycleLength); !reflect.DeepEqual(got, want) {
+        t.Errorf("cycles = %v, want %v", got, want)
+    }
+
+    out, err := ProcessNetting(intents)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(out) != 0 {
+        t.Errorf("residual = %v, want both cycles netted", out)
+    }
+}
+
+func TestCycleOrder(t *testing.T) {
+    // A 4-cycle of 8 and a 3-cycle of 3 share A -> B, which holds only 8
+    intents := []Intent{
+        {Sender: "A", Receiver: "B", Token: "T", Amount: 8},
+        {Sender: "B", Receiver: "C", Token: "T", Amount: 8},
+        {Sender: "C", Receiver: "D", Token: "T", Amount: 8},
+        {Sender: "D", Receiver: "A", Token: "T", Amount: 8},
+        {Sender: "B", Receiver: "E", Token: "T", Amount: 3},
+        {Sender: "E", Receiver: "A", Token: "T", Amount: 3},
+    }
+    largeFirst := []Intent{
+        {Sender: "B", Receiver: "E", Token: "T", Amount: 3},
+        {Sender: "E", Receiver: "A", Token: "T", Amount: 3},
+    }
+    shortFirst := []Intent{
+        {Sender: "B", Receiver: "C", Token: "T", Amount: 3},
+        {Sender: "C", Receiver: "D", Token: "T", Amount: 3},
+        {Sender: "D", Receiver: "A", Token: "T", Amount: 3},
+    }
+    for _, tt := range []struct {
+        order CycleOrder
+        want  []Intent
+    }{
+        {ByDiscovery, shortFirst},
+        {ByAmountDesc, largeFirst},
+        {ByLength, shortFirst},
+    } {
+        got, err := ProcessNettingWithOptions(intents, Options{CycleOrder: tt.order})
+        if err != nil {
+            t.Fatal(err)
+        }
+        if !IntentsEqual(got, tt.want) {
+            t.Errorf("order %d: residual = %v, want %v", tt.order, got, tt.want)
+        }
+    }
+}
+
+func TestCloneIndependent(t *testing.T) {
+    g, _, err := buildGraph(triangle("T", 5))
+    if err != nil {
+        t.Fatal(err)
+    }
+    g.EnableReverseIndex()
+    g.Edges["A"][0].Refs = []string{"r"}
+    before := g.ToIntents()
+
+    c := g.Clone()
+    if err := c.ApplyNetting([]string{"A", "B", "C"}, "T", 2); err != nil {
+        t.Fatal(err)
+    }
+    c.AddEdge("D", "A", "T", 1)
+    c.Edges["A"][0].Refs[0] = "changed"
+
+    if after := g.ToIntents(); !reflect.DeepEqual(after, before) {
+        t.Errorf("original = %v after mutating the clone, want %v", after, before)
+    }
+    if in := g.InEdges("A"); len(in) != 1 || in[0].Amount != 5 {
+        t.Errorf("original InEdges(A) = %v, want C -> A 5 only", in)
+    }
+}
+
+func TestSelfLoopDropped(t *testing.T) {
+    intents := append(triangle("T", 5), Intent{Sender: "D", Receiver: "D", Token: "T", Amount: 9})
+
+    var found [][]string
+    opts := Options{OnCycleFound: func(cycle []string) { found = append(found, cycle) }}
+    if _, err := ProcessNettingWithOptions(intents, opts); err != nil {
+        t.Fatal(err)
+    }
+    if want := [][]string{{"A", "B", "C"}}; !reflect.DeepEqual(found, want) {
+        t.Errorf("cycles = %v, want %v", found, want)
+    }
+
+    out, stats, err := ProcessNettingWithStats(intents)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(out) != 0 || stats.SelfLoopsDropped != 1 {
+        t.Errorf("residual %v with %d self-loops dropped, want none and 1", out, stats.SelfLoopsDropped)
+    }
+
+    if err := NewGraph().AddEdge("D", "D", "T", 1); !errors.Is(err, ErrSelfLoop) {
+        t.Errorf("AddEdge self-loop error = %v, want ErrSelfLoop", err)
+    }
+}
+
+func TestNettingOpsMatchEdges(t *testing.T) {
+    intents := randomIntents(rand.New(rand.NewSource(2)), 8, 2, 60)
+    out, ops, err := ProcessNettingWithOps(intents, Options{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(ops) == 0 {
+        t.Fatal("nothing netted")
+    }
+
+    // Every hop of every op lowers its edge by the op's amount
+    before, _, err := buildGraph(intents)
+    if err != nil {
+        t.Fatal(err)
+    }
+    reduced := make(map[EdgeKey]uint64)
+    for _, op := range ops {
+        for i, from := range op.Cycle {
+            reduced[EdgeKey{From: from, To: op.Cycle[(i+1)%len(op.Cycle)], Token: op.Token}] += op.Amount
+        }
+    }
+    after, _, err := buildGraph(out)
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, intent := range before.ToIntents() {
+        key := EdgeKey{From: intent.Sender, To: intent.Receiver, Token: intent.Token}
+        left, _ := after.GetEdge(key.From, key.To, key.Token)
+        if left+reduced[key] != intent.Amount {
+            t.Errorf("%v: %d before, %d after and %d netted", key, intent.Amount, left, reduced[key])
+        }
+        delete(reduced, key)
+    }
+    if len(reduced) != 0 {
+        t.Errorf("ops reduced edges that did not exist: %v", reduced)
+    }
+}
+
+func TestNetBilateral(t *testing.T) {
+    intents := []Intent{
+        {Sender: "A", Receiver: "B", Token: "T", Amount: 100},
+        {Sender: "B", Receiver: "A", Token: "T", Amount: 30},
+    }
+    searched := 0
+    opts := Options{
+        OnSCCFound:   func([]string) { searched++ },
+        OnCycleFound: func([]string) { searched++ },
+    }
+    out, ops, err := ProcessNettingWithOps(intents, opts)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if want := []Intent{{Sender: "A", Receiver: "B", Token: "T", Amount: 70}}; !IntentsEqual(out, want) {
+        t.Errorf("residual = %v, want %v", out, want)
+    }
+    if want := []NettingOp{{Cycle: []string{"A", "B"}, Token: "T", Amount: 30}}; !reflect.DeepEqual(ops, want) {
+        t.Errorf("ops = %v, want %v", ops, want)
+    }
+    if searched != 0 {
+        t.Errorf("cycle search ran %d callbacks after bilateral netting", searched)
+    }
+}
+
+func TestFindCyclesFigureEight(t *testing.T) {
+    // Two triangles through A; the walk round both revisits A
+    intents := append(triangle("T", 5),
+        Intent{Sender: "A", Receiver: "D", Token: "T", Amount: 5},
+        Intent{Sender: "D", Receiver: "E", Token: "T", Amount: 5},
+        Intent{Sender: "E", Receiver: "A", Token: "T", Amount: 5},
+    )
+    want := [][]string{{"A", "B", "C"}, {"A", "D", "E"}}
+    if got := allCycles(t, intents, 6); !reflect.DeepEqual(got, want) {
+        t.Errorf("cycles = %v, want %v", got, want)
+    }
+}
+
+func TestFindCyclesMaxLength(t *testing.T) {
+    ring := func(n int) []Intent {
+        intents := make([]Intent, n)
+        for i := range intents {
+            intents[i] = Intent{Sender: fmt.Sprint(i), Receiver: fmt.Sprint((i + 1) % n), Token: "T", Amount: 1}
+        }
+        return intents
+    }
+    if got := allCycles(t, ring(5), 4); len(got) != 0 {
+        t.Errorf("5-ring with max length 4: cycles = %v, want none", got)
+    }
+    if got := allCycles(t, ring(5), 5); len(got) != 1 {
+        t.Errorf("5-ring with max length 5: cycles = %v, want one", got)
+    }
+}
+
+func TestLogger(t *testing.T) {
+    var buf bytes.Buffer
+    if _, err := ProcessNettingWithOptions(triangle("T", 5), Options{Logger: log.New(&buf, "", 0)}); err != nil {
+        t.Fatal(err)
+    }
+    want := `netting: found 1 SCCs
+netting: SCC [C B A] has 1 cycles
+netting: cycle [A B C]
+netting: cycle [A B C] netted 5 T
+`
+    if buf.String() != want {
+        t.Errorf("log =\n%s\nwant\n%s", buf.String(), want)
+    }
+}
+
+func TestPreviewNettingLeavesGraph(t *testing.T) {
+    g, _, err := buildGraph(randomIntents(rand.New(rand.NewSource(4)), 8, 2, 50))
+    if err != nil {
+        t.Fatal(err)
+    }
+    before, err := g.ToJSON()
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    out, ops, err := g.PreviewNetting(Options{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(ops) == 0 {
+        t.Fatal("preview netted nothing")
+    }
+    if after, _ := g.ToJSON(); !bytes.Equal(after, before) {
+        t.Errorf("graph changed by preview:\n%s\nwant\n%s", after, before)
+    }
+
+    // The preview is what netting the graph does
+    if _, _, err := g.netCycles(context.Background(), Options{MaxCycleLength: DefaultMaxCycleLength}); err != nil {
+        t.Fatal(err)
+    }
+    if !IntentsEqual(out, g.ToIntents()) {
+        t.Errorf("preview = %v, netting left %v", out, g.ToIntents())
+    }
+}
+
+func TestProcessNettingEmpty(t *testing.T) {
+    for _, in := range [][]Intent{nil, {}} {
+        out, err := ProcessNetting(in)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if out == nil || len(out) != 0 {
+            t.Errorf("ProcessNetting(%#v) = %#v, want an empty non-nil slice", in, out)
+        }
+    }
+
+    one := []Intent{{Sender: "A", Receiver: "B", Token: "T", Amount: 7}}
+    out, err := ProcessNetting(one)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !reflect.DeepEqual(out, one) {
+        t.Errorf("ProcessNetting(%v) = %v, want it unchanged", one, out)
+    }
+}
+
+func TestNettingOpHops(t *testing.T) {
+    intents := append(triangle("T", 5),
+        Intent{Sender: "D", Receiver: "E", Token: "T", Amount: 2},
+        Intent{Sender: "E", Receiver: "D", Token: "T", Amount: 2},
+    )
+    _, ops, err := ProcessNettingWithOps(intents, Options{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(ops) != 2 {
+        t.Fatalf("ops = %v, want a bilateral and a triangle step", ops)
+    }
+    for _, op := range ops {
+        if op.Hops() != len(op.Cycle) {
+            t.Errorf("%v: Hops = %d, want %d", op, op.Hops(), len(op.Cycle))
+        }
+    }
+    if ops[0].Hops() != 2 || ops[1].Hops() != 3 {
+        t.Errorf("hops = %d, %d, want 2, 3", ops[0].Hops(), ops[1].Hops())
+    }
+}
+
+func TestRefsThroughBilateral(t *testing.T) {
+    out, err := ProcessNetting([]Intent{
+        {Sender: "A", Receiver: "B", Token: "T", Amount: 60, ID: "tx1"},
+        {Sender: "A", Receiver: "B", Token: "T", Amount: 40, ID: "tx2"},
+        {Sender: "B", Receiver: "A", Token: "T", Amount: 30, ID: "tx3"},
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := []Intent{{Sender: "A", Receiver: "B", Token: "T", Amount: 70, Refs: []string{"tx1", "tx2"}}}
+    if !reflect.DeepEqual(out, want) {
+        t.Errorf("ProcessNetting = %v, want %v", out, want)
+    }
+}
+
+func TestApplyNettingTooMuch(t *testing.T) {
+    g, _, err := buildGraph([]Intent{
+        {Sender: "A", Receiver: "B", Token: "T", Amount: 10},
+        {Sender: "B", Receiver: "C", Token: "T", Amount: 4},
+        {Sender: "C", Receiver: "A", Token: "T", Amount: 10},
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    before := g.Clone()
+    if err := g.ApplyNetting([]string{"A", "B", "C"}, "T", 5); err == nil {
+        t.Fatal("ApplyNetting netted more than B -> C holds")
+    }
+    if !reflect.DeepEqual(g.Edges, before.Edges) {
+        t.Errorf("graph = %v after a rejected netting, want %v", g.Edges, before.Edges)
+    }
+    if err := g.ApplyNetting([]string{"A", "B", "D"}, "T", 1); err == nil {
+        t.Error("ApplyNetting netted a missing edge")
+    }
+}
+
+func TestBilateralDefaultOptions(t *testing.T) {
+    intents := []Intent{
+        {Sender: "A", Receiver: "B", Token: "T", Amount: 30},
+        {Sender: "B", Receiver: "A", Token: "T", Amount: 20},
+    }
+    if cycles := allCycles(t, intents, 2); !reflect.DeepEqual(cycles, [][]string{{"A", "B"}}) {
+        t.Errorf("cycles = %v, want [[A B]]", cycles)
+    }
+    out, err := ProcessNettingWithOptions(intents, Options{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := []Intent{{Sender: "A", Receiver: "B", Token: "T", Amount: 10}}
+    if !reflect.DeepEqual(out, want) {
+        t.Errorf("ProcessNettingWithOptions = %v, want %v", out, want)
+    }
+}
+
+func TestMerge(t *testing.T) {
+    g := NewGraph()
+    g.AddEdge("A", "B", "T", 10)
+    g.AddEdge("B", "C", "T", 5)
+    other := NewGraph()
+    other.AddEdge("A", "B", "T", 7)
+    other.AddEdge("A", "B", "U", 3)
+    other.AddEdge("C", "A", "T", 2)
+
+    if err := g.Merge(other); err != nil {
+        t.Fatal(err)
+    }
+    want := []Intent{
+        {Sender: "A", Receiver: "B", Token: "T", Amount: 17},
+        {Sender: "A", Receiver: "B", Token: "U", Amount: 3},
+        {Sender: "B", Receiver: "C", Token: "T", Amount: 5},
+        {Sender: "C", Receiver: "A", Token: "T", Amount: 2},
+    }
+    if got := g.ToIntents(); !reflect.DeepEqual(got, want) {
+        t.Errorf("merged = %v, want %v", got, want)
+    }
+    if amount, _ := other.GetEdge("A", "B", "T"); amount != 7 {
+        t.Errorf("other A -> B = %d after Merge, want 7", amount)
+    }
+
+    // An overflowing sum leaves g as it was
+    big := NewGraph()
+    big.AddEdge("B", "C", "T", 1)
+    big.AddEdge("A", "B", "T", math.MaxUint64)
+    if err := g.Merge(big); !errors.Is(err, ErrAmountOverflow) {
+        t.Fatalf("Merge error = %v, want ErrAmountOverflow", err)
+    }
+    if got := g.ToIntents(); !reflect.DeepEqual(got, want) {
+        t.Errorf("graph = %v after a rejected Merge, want %v", got, want)
+    }
+}
+
+func TestBalancedCycleStable(t *testing.T) {
+    // Every hop holds 5, so each cycle zeroes all its edges, and A -> B can
+    // only go to one of the two cycles through it
+    intents := append(triangle("T", 5),
+        Intent{Sender: "B", Receiver: "D", Token: "T", Amount: 5},
+        Intent{Sender: "D", Receiver: "A", Token: "T", Amount: 5},
+    )
+    want := []Intent{
+        {Sender: "B", Receiver: "C", Token: "T", Amount: 5},
+        {Sender: "C", Receiver: "A", Token: "T", Amount: 5},
+    }
+    for run := 0; run < 20; run++ {
+        out, err := ProcessNetting(intents)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if !reflect.DeepEqual(out, want) {
+            t.Fatalf("run %d: ProcessNetting = %v, want %v", run, out, want)
+        }
+    }
+}
+
+func TestAllCyclesAcrossComponents(t *testing.T) {
+    // Two separate triangles, a 2-cycle and a chain with no cycle
+    g, _, err := buildGraph(append(triangle("T", 5),
+        Intent{Sender: "X", Receiver: "Y", Token: "T", Amount: 5},
+        Intent{Sender: "Y", Receiver: "Z", Token: "T", Amount: 5},
+        Intent{Sender: "Z", Receiver: "X", Token: "T", Amount: 5},
+        Intent{Sender: "P", Receiver: "Q", Token: "U", Amount: 5},
+        Intent{Sender: "Q", Receiver: "P", Token: "U", Amount: 5},
+        Intent{Sender: "Q", Receiver: "R", Token: "U", Amount: 5},
+    ))
+    if err != nil {
+        t.Fatal(err)
+    }
+    cycles := g.AllCycles(4)
+    sort.Slice(cycles, func(i, j int) bool { return fmt.Sprint(cycles[i]) < fmt.Sprint(cycles[j]) })
+    want := [][]string{{"A", "B", "C"}, {"P", "Q"}, {"X", "Y", "Z"}}
+    if !reflect.DeepEqual(cycles, want) {
+        t.Errorf("AllCycles = %v, want %v", cycles, want)
+    }
+}
+
+func TestNodesIncludesReceivers(t *testing.T) {
+    g := NewGraph()
+    g.AddEdge("B", "A", "T", 5)
+    g.AddEdge("B", "D", "U", 5)
+    g.AddEdge("C", "B", "T", 5)
+    // A and D only receive
+    want := []string{"A", "B", "C", "D"}
+    if got := g.Nodes(); !reflect.DeepEqual(got, want) {
+        t.Errorf("Nodes = %v, want %v", got, want)
+    }
+}
+
+func TestLargestNettableCycle(t *testing.T) {
+    g, _, err := buildGraph([]Intent{
+        // A triangle netting 3
+        {Sender: "A", Receiver: "B", Token: "T", Amount: 3},
+        {Sender: "B", Receiver: "C", Token: "T", Amount: 9},
+        {Sender: "C", Receiver: "A", Token: "T", Amount: 9},
+        // A 4-cycle through the same B -> C netting 8
+        {Sender: "C", Receiver: "D", Token: "T", Amount: 8},
+        {Sender: "D", Receiver: "E", Token: "T", Amount: 20},
+        {Sender: "E", Receiver: "B", Token: "T", Amount: 8},
+        // A separate pair netting 5, and a larger U cycle that does not count
+        {Sender: "X", Receiver: "Y", Token: "T", Amount: 5},
+        {Sender: "Y", Receiver: "X", Token: "T", Amount: 6},
+        {Sender: "X", Receiver: "Y", Token: "U", Amount: 50},
+        {Sender: "Y", Receiver: "X", Token: "U", Amount: 50},
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    cycle, amount, ok := g.LargestNettableCycle("T", 4)
+    if !ok || amount != 8 || !reflect.DeepEqual(cycle, []string{"B", "C", "D", "E"}) {
+        t.Errorf("LargestNettableCycle = %v, %d, %v, want [B C D E], 8, true", cycle, amount, ok)
+    }
+    if _, _, ok := g.LargestNettableCycle("V", 4); ok {
+        t.Error("LargestNettableCycle found a cycle in a token with no debts")
+    }
+}
+
+func TestNetToken(t *testing.T) {
+    intents := []Intent{
+        {Sender: "A", Receiver: "B", Token: "X", Amount: 10},
+        {Sender: "B", Receiver: "C", Token: "X", Amount: 7},
+        {Sender: "C", Receiver: "A", Token: "X", Amount: 4},
+        {Sender: "D", Receiver: "A", Token: "X", Amount: 3},
+        {Sender: "A", Receiver: "B", Token: "Y", Amount: 5},
+        {Sender: "B", Receiver: "A", Token: "Y", Amount: 2},
+        {Sender: "B", Receiver: "C", Token: "Y", Amount: 9},
+    }
+    full, err := ProcessNetting(intents)
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, token := range []string{"X", "Y"} {
+        var want []Intent
+        for _, intent := range full {
+            if intent.Token == token {
+                want = append(want, intent)
+            }
+        }
+        got, err := NetToken(intents, token)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if !reflect.DeepEqual(got, want) {
+            t.Errorf("NetToken(%s) = %v, want %v", token, got, want)
+        }
+    }
+    if got, err := NetToken(intents, "Z"); err != nil || len(got) != 0 {
+        t.Errorf("NetToken(Z) = %v, %v, want nothing", got, err)
+    }
+
+    // Tokens sharing participants and so SCCs must not change each other's
+    // netting
+    r := rand.New(rand.NewSource(12))
+    for trial := 0; trial < 30; trial++ {
+        intents := randomIntents(r, 6, 3, 40)
+        full, err := ProcessNetting(intents)
+        if err != nil {
+            t.Fatal(err)
+        }
+        g, _, err := buildGraph(full)
+        if err != nil {
+            t.Fatal(err)
+        }
+        subs := g.SplitByToken()
+        for k := 0; k < 3; k++ {
+            token := fmt.Sprintf("t%d", k)
+            got, err := NetToken(intents, token)
+            if err != nil {
+                t.Fatal(err)
+            }
+            want := []Intent{}
+            if sub := subs[token]; sub != nil {
+                want = sub.ToIntents()
+            }
+            if !IntentsEqual(got, want) {
+                t.Errorf("trial %d: NetToken(%s) = %v, ProcessNetting left %v", trial, token, got, want)
+            }
+        }
+    }
+}
+
+func TestCyclesIteratorFirstN(t *testing.T) {
+    g, _, err := buildGraph(complete(5))
+    if err != nil {
+        t.Fatal(err)
+    }
+    scc := g.FindSCCs()[0]
+    all := g.FindCycles(scc, 5)
+    const n = 7
+    if len(all) <= n {
+        t.Fatalf("K5 has only %d cycles", len(all))
+    }
+
+    var first [][]string
+    g.Cycles(scc, 5, func(cycle []string) bool {
+        first = append(first, cycle)
+        return len(first) < n
+    })
+    if !reflect.DeepEqual(first, all[:n]) {
+        t.Errorf("first %d cycles = %v, want %v", n, first, all[:n])
+    }
+
+    count := 0
+    g.Cycles(scc, 5, func([]string) bool { count++; return true })
+    if count != len(all) {
+        t.Errorf("iterator yielded %d cycles, FindCycles %d", count, len(all))
+    }
+}
+
+// fuzzIntents decodes data four bytes to an intent: sender, receiver and
+// token picked from small sets so cycles are common, and an amount of 1 to
+// 256
+func fuzzIntents(data []byte) []Intent {
+    intents := make([]Intent, 0, len(data)/4)
+    for ; len(data) >= 4; data = data[4:] {
+        intents = append(intents, Intent{
+            Sender:   fmt.Sprintf("n%d", data[0]%6),
+            Receiver: fmt.Sprintf("n%d", data[1]%6),
+            Token:    fmt.Sprintf("t%d", data[2]%2),
+            Amount:   uint64(data[3]) + 1,
+        })
+    }
+    return intents
+}
+
+func FuzzProcessNetting(f *testing.F) {
+    // The triangle n0 -> n1 -> n2 -> n0 and the pair n0 <-> n1
+    f.Add([]byte{0, 1, 0, 9, 1, 2, 0, 6, 2, 0, 0, 4})
+    f.Add([]byte{0, 1, 0, 29, 1, 0, 0, 19})
+    f.Fuzz(func(t *testing.T, data []byte) {
+        in := fuzzIntents(data)
+        out, err := ProcessNetting(in)
+        if err != nil {
+            t.Fatalf("ProcessNetting(%v): %v", in, err)
+        }
+        if err := VerifyConservation(in, out); err != nil {
+            t.Fatalf("ProcessNetting(%v) = %v: %v", in, out, err)
+        }
+    })
+}
+
+func TestReversal(t *testing.T) {
+    e := NewNettingEngine()
+    if err := e.AddIntent(Intent{Sender: "A", Receiver: "B", Token: "T", Amount: 50}); err != nil {
+        t.Fatal(err)
+    }
+    if err := e.AddIntent(Intent{Sender: "A", Receiver: "B", Token: "T", Amount: 20, Reverse: true}); err != nil {
+        t.Fatal(err)
+    }
+    want := []Intent{{Sender: "A", Receiver: "B", Token: "T", Amount: 30}}
+    if got := e.Intents(); !reflect.DeepEqual(got, want) {
+        t.Errorf("after partial reversal = %v, want %v", got, want)
+    }
+
+    // Reversing more than is owed fails and changes nothing
+    if err := e.AddIntent(Intent{Sender: "A", Receiver: "B", Token: "T", Amount: 31, Reverse: true}); !errors.Is(err, ErrReversalExceedsDebt) {
+        t.Errorf("oversized reversal = %v, want ErrReversalExceedsDebt", err)
+    }
+    if err := e.AddIntent(Intent{Sender: "A", Receiver: "B", Token: "T", Amount: 30, Reverse: true}); err != nil {
+        t.Fatal(err)
+    }
+    if got := e.Intents(); len(got) != 0 {
+        t.Errorf("after full reversal = %v, want none", got)
+    }
+
+    out, err := ProcessNetting([]Intent{
+        {Sender: "A", Receiver: "B", Token: "T", Amount: 50},
+        {Sender: "A", Receiver: "B", Token: "T", Amount: 50, Reverse: true},
+    })
+    if err != nil || len(out) != 0 {
+        t.Errorf("ProcessNetting of a full reversal = %v, %v, want none", out, err)
+    }
+}
+
+func TestAnalyzeTwoSCCs(t *testing.T) {
+    // The triangle feeds the X, Y pair, which pays out to Z
+    g, _, err := buildGraph(append(triangle("T", 5),
+        Intent{Sender: "C", Receiver: "X", Token: "T", Amount: 1},
+        Intent{Sender: "X", Receiver: "Y", Token: "T", Amount: 1},
+        Intent{Sender: "Y", Receiver: "X", Token: "T", Amount: 1},
+        Intent{Sender: "Y", Receiver: "Z", Token: "T", Amount: 1},
+    ))
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := []SCCReport{
+        {Members: []string{"X", "Y"}, Cycles: [][]string{{"X", "Y"}}},
+        {Members: []string{"A", "B", "C"}, Cycles: [][]string{{"A", "B", "C"}}},
+    }
+    if got := g.Analyze(4); !reflect.DeepEqual(got, want) {
+        t.Errorf("Analyze = %v, want %v", got, want)
+    }
+}
+
+func TestFindSCCsSinkNode(t *testing.T) {
+    // Z never sends, so it has no Edges entry; it is reached first from A
+    // and again from C
+    g := NewGraph()
+    g.AddEdge("A", "Z", "T", 1)
+    g.AddEdge("A", "B", "T", 5)
+    g.AddEdge("B", "C", "T", 5)
+    g.AddEdge("C", "A", "T", 5)
+    g.AddEdge("C", "Z", "T", 2)
+    if _, ok := g.Edges["Z"]; ok {
+        t.Fatal("sink Z has an Edges entry")
+    }
+
+    sccs := g.FindSCCs()
+    if len(sccs) != 1 {
+        t.Fatalf("FindSCCs = %v, want only the triangle", sccs)
+    }
+    members := append([]string(nil), sccs[0]...)
+    sort.Strings(members)
+    if !reflect.DeepEqual(members, []string{"A", "B", "C"}) {
+        t.Errorf("SCC = %v, want A, B and C", sccs[0])
+    }
+
+    out, err := ProcessNetting(g.ToIntents())
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := []Intent{
+        {Sender: "A", Receiver: "Z", Token: "T", Amount: 1},
+        {Sender: "C", Receiver: "Z", Token: "T", Amount: 2},
+    }
+    if !reflect.DeepEqual(out, want) {
+        t.Errorf("ProcessNetting = %v, want %v", out, want)
+    }
+}
+
+// naiveCycles finds the cycles of g by walking every simple path from every
+// node and deduplicating the rotations
+func naiveCycles(g *Graph) map[string]bool {
+    cycles := make(map[string]bool)
+    var path []string
+    var walk func(v string)
+    walk = func(v string) {
+        path = append(path, v)
+        for _, edge := range g.Edges[v] {
+            switch {
+            case edge.To == path[0]:
+                if len(path) >= 2 {
+                    cycles[fmt.Sprint(g.canonicalCycle(path))] = true
+                }
+            case !slices.Contains(path, edge.To):
+                walk(edge.To)
+            }
+        }
+        path = path[:len(path)-1]
+    }
+    for _, v := range g.sources() {
+        walk(v)
+    }
+    return cycles
+}
+
+func TestFindCyclesJohnsonMatchesDFS(t *testing.T) {
+    graphs := [][]Intent{complete(5), triangle("T", 1)}
+    r := rand.New(rand.NewSource(8))
+    for i := 0; i < 10; i++ {
+        graphs = append(graphs, randomIntents(r, 7, 2, 16+2*i))
+    }
+
+    for i, intents := range graphs {
+        g, _, err := buildGraph(intents)
+        if err != nil {
+            t.Fatal(err)
+        }
+        want := naiveCycles(g)
+
+        // At len(g.Edges) the search blocks nodes; one less it does not
+        n := len(g.Edges)
+        got := make(map[string]bool)
+        short := make(map[string]bool)
+        for _, scc := range g.FindSCCs() {
+            for _, cycle := range g.FindCycles(scc, n) {
+                key := fmt.Sprint(cycle)
+                if got[key] {
+                    t.Errorf("graph %d: %v found twice", i, cycle)
+                }
+                got[key] = true
+            }
+            for _, cycle := range g.FindCycles(scc, n-1) {
+                short[fmt.Sprint(cycle)] = true
+            }
+        }
+        if !reflect.DeepEqual(got, want) {
+            t.Errorf("graph %d: blocking search found %d cycles, plain DFS %d", i, len(got), len(want))
+        }
+        for key := range want {
+            // Only cycles through every node are too long
+            if strings.Count(key, " ") == n-1 {
+                delete(want, key)
+            }
+        }
+        if !reflect.DeepEqual(short, want) {
+            t.Errorf("graph %d: depth-limited search found %d cycles, plain DFS %d", i, len(short), len(want))
+        }
+    }
+}
+
+func TestNewIntent(t *testing.T) {
+    intent, err := NewIntent("A", "B", "T", 5)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if want := (Intent{Sender: "A", Receiver: "B", Token: "T", Amount: 5}); !reflect.DeepEqual(intent, want) {
+        t.Errorf("NewIntent = %v, want %v", intent, want)
+    }
+
+    for _, c := range []struct {
+        sender, receiver, token string
+        amount                  uint64
+        want                    string
+    }{
+        {"", "B", "T", 5, "empty sender"},
+        {"A", "", "T", 5, "empty receiver"},
+        {"A", "B", "", 5, "empty token"},
+        {"A", "B", "T", 0, "zero amount"},
+        {"A", "A", "T", 5, ErrSelfLoop.Error()},
+    } {
+        intent, err := NewIntent(c.sender, c.receiver, c.token, c.amount)
+        if err == nil || err.Error() != c.want {
+            t.Errorf("NewIntent(%q, %q, %q, %d) error = %v, want %s", c.sender, c.receiver, c.token, c.amount, err, c.want)
+        }
+        if !reflect.DeepEqual(intent, Intent{}) {
+            t.Errorf("NewIntent(%q, %q, %q, %d) = %v with an error", c.sender, c.receiver, c.token, c.amount, intent)
+        }
+    }
+    if _, err := NewIntent("A", "A", "T", 5); !errors.Is(err, ErrSelfLoop) {
+        t.Errorf("self-loop error = %v, want ErrSelfLoop", err)
+    }
+}
+
+func TestSplitByToken(t *testing.T) {
+    g, _, err := buildGraph(randomIntents(rand.New(rand.NewSource(9)), 8, 3, 60))
+    if err != nil {
+        t.Fatal(err)
+    }
+    subs := g.SplitByToken()
+    if len(subs) != 3 {
+        t.Fatalf("SplitByToken gave %d graphs, want 3", len(subs))
+    }
+
+    var joined []Intent
+    for token, sub := range subs {
+        for _, intent := range sub.ToIntents() {
+            if intent.Token != token {
+                t.Errorf("%s graph has edge %v", token, intent)
+            }
+            joined = append(joined, intent)
+        }
+    }
+    if !IntentsEqual(joined, g.ToIntents()) {
+        t.Errorf("split graphs hold %v, want %v", joined, g.ToIntents())
+    }
+
+    // The split graphs share nothing with g
+    sub := subs["t0"]
+    for from := range sub.Edges {
+        sub.Edges[from][0].Amount++
+        break
+    }
+    if !IntentsEqual(joined, g.ToIntents()) {
+        t.Error("changing a split graph changed g")
+    }
+}
+
+func TestReset(t *testing.T) {
+    g := NewGraph()
+    g.EnableReverseIndex()
+    g.AddEdge("A", "B", "T", 5)
+    g.AddEdge("B", "C", "T", 7)
+    g.Reset()
+    if len(g.Edges) != 0 || len(g.ToIntents()) != 0 || len(g.InEdges("B")) != 0 {
+        t.Fatalf("graph after Reset = %v", g.Edges)
+    }
+    if _, ok := g.GetEdge("A", "B", "T"); ok {
+        t.Error("A -> B still found after Reset")
+    }
+
+    // Refilled, amounts start again from zero and the index is still kept
+    g.AddEdge("A", "B", "T", 2)
+    want := []Intent{{Sender: "A", Receiver: "B", Token: "T", Amount: 2}}
+    if got := g.ToIntents(); !reflect.DeepEqual(got, want) {
+        t.Errorf("refilled graph = %v, want %v", got, want)
+    }
+    if in := g.InEdges("B"); !reflect.DeepEqual(in, []Edge{{To: "A", Token: "T", Amount: 2}}) {
+        t.Errorf("InEdges(B) = %v after refilling", in)
+    }
+}
+
+func TestApplyNettingBatchAtomic(t *testing.T) {
+    g, _, err := buildGraph(append(triangle("T", 10), triangle("U", 3)...))
+    if err != nil {
+        t.Fatal(err)
+    }
+    before := g.ToIntents()
+    abc := []string{"A", "B", "C"}
+
+    for name, ops := range map[string][]NettingOp{
+        // Each fits alone, but together they net 11 of 10
+        "too much": {
+            {Cycle: abc, Token: "T", Amount: 4},
+            {Cycle: abc, Token: "U", Amount: 3},
+            {Cycle: abc, Token: "T", Amount: 7},
+        },
+        "missing edge": {
+            {Cycle: abc, Token: "T", Amount: 4},
+            {Cycle: []string{"A", "C"}, Token: "T", Amount: 1},
+        },
+    } {
+        if err := g.ApplyNettingBatch(ops); err == nil {
+            t.Errorf("%s: batch applied", name)
+        }
+        if got := g.ToIntents(); !reflect.DeepEqual(got, before) {
+            t.Errorf("%s: graph = %v after a rejected batch, want %v", name, got, before)
+        }
+    }
+
+    err = g.ApplyNettingBatch([]NettingOp{
+        {Cycle: abc, Token: "T", Amount: 4},
+        {Cycle: abc, Token: "U", Amount: 3},
+        {Cycle: []string{"B", "C", "A"}, Token: "T", Amount: 6},
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    if got := g.ToIntents(); len(got) != 0 {
+        t.Errorf("graph = %v after a full batch, want empty", got)
+    }
+}
@@ -0,0 +1,243 @@
+package netting
+
+import (
+    "fmt"
+    "math"
+    "sort"
+)
+
+// arc is an edge of the residual network used by OptimalNetSingleToken
+type arc struct {
+    from, to int
+    // cap is how much more flow the arc takes and cost is -1 for netting
+    // more of a debt or +1 for undoing netting already done
+    cap  uint64
+    cost int
+}
+
+// negativeCycle returns the arcs of a cycle of negative total cost among the
+// arcs with spare capacity, or nil if there is none
+func negativeCycle(nodes int, arcs []arc) []int {
+    // Bellman-Ford from a virtual source joined to every node at cost 0
+    dist := make([]int, nodes)
+    pred := make([]int, nodes)
+    for i := range pred {
+        pred[i] = -1
+    }
+
+    if nodes == 0 {
+        return nil
+    }
+    last := -1
+    for round := 0; round < nodes; round++ {
+        last = -1
+        for i, a := range arcs {
+            if a.cap > 0 && dist[a.from]+a.cost < dist[a.to] {
+                dist[a.to] = dist[a.from] + a.cost
+                pred[a.to] = i
+                last = a.to
+            }
+        }
+        if last < 0 {
+            return nil
+        }
+    }
+
+    // Something still relaxed after nodes rounds, so last is reachable from
+    // a negative cycle; stepping back nodes times lands on the cycle itself
+    v := last
+    for i := 0; i < nodes; i++ {
+        v = arcs[pred[v]].from
+    }
+    cycle := make([]int, 0)
+    for u := v; ; {
+        cycle = append(cycle, pred[u])
+        u = arcs[pred[u]].from
+        if u == v {
+            break
+        }
+    }
+    return cycle
+}
+
+// OptimalNetSingleToken nets the intents in token optimally rather than
+// cycle by cycle. It finds the largest circulation that fits within the
+// existing debts and removes it, which leaves every participant's net
+// position intact, creates no debt between parties that did not owe each
+// other, and minimizes the remaining volume in token. Intents in other
+// tokens are returned unchanged, merged per edge like ProcessNetting does.
+//
+// The circulation is found by cancelling negative cycles in the residual
+// network, which is far slower than the cycle heuristic on large graphs.
+func OptimalNetSingleToken(intents []Intent, token string) ([]Intent, error) {
+    return OptimalNetSingleTokenWithLimits(intents, token, nil)
+}
+
+// OptimalNetSingleTokenWithLimits is OptimalNetSingleToken with credit
+// limits as the capacities of the flow. A pair with a limit in token may be
+// made to owe up to it, so debt elsewhere can be routed through the pair
+// where that lowers the volume, and a debt above its limit must be netted
+// down to it; pairs without a limit can only owe less. If some debt cannot
+// be brought within its limit an error wrapping ErrCreditLimit is returned.
+func OptimalNetSingleTokenWithLimits(intents []Intent, token string, limits map[EdgeKey]uint64) ([]Intent, error) {
+    g, _, err := buildGraph(intents)
+    if err != nil {
+        return nil, err
+    }
+    if err := g.netCirculation(token, limits); err != nil {
+        return nil, err
+    }
+    return g.ToIntents(), nil
+}
+
+// flowPair is a pair of participants in a circulation: a debt, which may be
+// netted, or a pair with a credit limit, which may be made to owe more
+type flowPair[N comparable] struct {
+    from, to N
+    owed     uint64
+    // net and excess index the arcs netting the debt within and above its
+    // limit, and raise the arc adding to it; -1 if there is none
+    net, excess, raise int
+    // netted and raised are how much the circulation found takes off and
+    // adds to the debt
+    netted, raised uint64
+}
+
+// netCirculation nets g's debts in token by the circulation that leaves the
+// least volume, as OptimalNetSingleTokenWithLimits describes. If a debt
+// stays above its limit g is left unchanged and an error wrapping
+// ErrCreditLimit is returned.
+func (g *GraphOf[N]) netCirculation(token string, limits map[EdgeKeyOf[N]]uint64) error {
+    pairs, err := g.circulate(token, nil, nil, limits)
+    if err != nil {
+        return err
+    }
+    for _, p := range pairs {
+        switch {
+        case p.netted > p.raised:
+            g.subtract(p.from, p.to, token, p.netted-p.raised)
+        case p.raised > p.netted:
+            // Within the limit, so this cannot overflow
+            g.AddEdge(p.from, p.to, token, p.raised-p.netted)
+        }
+    }
+    return nil
+}
+
+// circulate finds the circulation of least cost through g's debts in token
+// and the pairs limits lets owe more, as OptimalNetSingleTokenWithLimits
+// describes, without changing g. It returns every pair with what the
+// circulation nets and raises, or an error wrapping ErrCreditLimit if a debt
+// stays above its limit. If members is not nil only debts between members
+// are taken, and if spare is not nil it gives how much of a debt of owed
+// may be netted; it is not combined with limits.
+func (g *GraphOf[N]) circulate(token string, members map[N]bool, spare func(from, to N, owed uint64) uint64, limits map[EdgeKeyOf[N]]uint64) ([]flowPair[N], error) {
+    pairs := make([]flowPair[N], 0)
+    for _, from := range g.sources() {
+        if members != nil && !members[from] {
+            continue
+        }
+        for _, edge := range g.Edges[from] {
+            if edge.Token == token && (members == nil || members[edge.To]) {
+                pairs = append(pairs, flowPair[N]{from: from, to: edge.To, owed: edge.Amount})
+            }
+        }
+    }
+    // Pairs owing nothing yet are taken in sorted order, so the result does
+    // not depend on map iteration
+    fresh := make([]flowPair[N], 0)
+    for key, limit := range limits {
+        if _, owes := g.GetEdge(key.From, key.To, token); key.Token == token && limit > 0 && !owes && key.From != key.To {
+            fresh = append(fresh, flowPair[N]{from: key.From, to: key.To})
+        }
+    }
+    sort.Slice(fresh, func(i, j int) bool {
+        if c := g.compare(fresh[i].from, fresh[j].from); c != 0 {
+            return c < 0
+        }
+        return g.compare(fresh[i].to, fresh[j].to) < 0
+    })
+    pairs = append(pairs, fresh...)
+
+    // Number the nodes and give each pair arcs: netting a debt is flow in
+    // its direction at cost -1 and raising it flow against it at cost +1,
+    // each arc with a partner that can undo it
+    ids := make(map[N]int)
+    id := func(node N) int {
+        if i, ok := ids[node]; ok {
+            return i
+        }
+        ids[node] = len(ids)
+        return len(ids) - 1
+    }
+    for _, p := range pairs {
+        id(p.from)
+        id(p.to)
+    }
+    // Netting excess outweighs any volume a cycle of at most len(ids) hops
+    // could add, so debts are brought within their limits first
+    excessCost := -(len(ids) + 1)
+    arcs := make([]arc, 0)
+    add := func(from, to N, cap uint64, cost int) int {
+        if cap == 0 {
+            return -1
+        }
+        arcs = append(arcs,
+            arc{from: ids[from], to: ids[to], cap: cap, cost: cost},
+            arc{from: ids[to], to: ids[from], cap: 0, cost: -cost})
+        return len(arcs) - 2
+    }
+    for i := range pairs {
+        p := &pairs[i]
+        limit, limited := limits[EdgeKeyOf[N]{From: p.from, To: p.to, Token: token}]
+        switch {
+        case !limited:
+            nettable := p.owed
+            if spare != nil {
+                nettable = spare(p.from, p.to, p.owed)
+            }
+            p.net, p.excess, p.raise = add(p.from, p.to, nettable, -1), -1, -1
+        case p.owed > limit:
+            p.net, p.excess, p.raise = add(p.from, p.to, limit, -1), add(p.from, p.to, p.owed-limit, excessCost), -1
+        default:
+            p.net, p.excess, p.raise = add(p.from, p.to, p.owed, -1), -1, add(p.to, p.from, limit-p.owed, 1)
+        }
+    }
+
+    // Push flow around negative cycles until none are left; the flow is
+    // then a circulation of least cost
+    for {
+        cycle := negativeCycle(len(ids), arcs)
+        if cycle == nil {
+            break
+        }
+        push := uint64(math.MaxUint64)
+        for _, i := range cycle {
+            push = min(push, arcs[i].cap)
+        }
+        for _, i := range cycle {
+            // Arcs come in forward/backward pairs, so i^1 is the partner
+            arcs[i].cap -= push
+            arcs[i^1].cap += push
+        }
+    }
+
+    // The flow on an arc is the spare capacity of its partner
+    flow := func(i int) uint64 {
+        if i < 0 {
+            return 0
+        }
+        return arcs[i^1].cap
+    }
+    for i := range pairs {
+        p := &pairs[i]
+        if p.excess >= 0 && arcs[p.excess].cap > 0 {
+            limit := limits[EdgeKeyOf[N]{From: p.from, To: p.to, Token: token}]
+            return nil, fmt.Errorf("%v -> %v %s: owes %d after netting, limit %d: %w",
+                p.from, p.to, token, limit+arcs[p.excess].cap, limit, ErrCreditLimit)
+        }
+        p.netted = flow(p.net) + flow(p.excess)
+        p.raised = flow(p.raise)
+    }
+    return pairs, nil
+}
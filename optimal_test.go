@@ -0,0 +1,62 @@
+package netting
+
+import (
+    "math/rand"
+    "testing"
+)
+
+// volume returns the total amount of intents
+func volume(intents []Intent) uint64 {
+    var total uint64
+    for _, intent := range intents {
+        total += intent.Amount
+    }
+    return total
+}
+
+func TestOptimalNetSingleToken(t *testing.T) {
+    // The 3-cycle found first takes 3 off the shared A -> B, leaving the
+    // 4-cycle only 5 to net; netting the 4-cycle alone removes more
+    intents := []Intent{
+        {Sender: "A", Receiver: "B", Token: "T", Amount: 8},
+        {Sender: "B", Receiver: "C", Token: "T", Amount: 8},
+        {Sender: "C", Receiver: "D", Token: "T", Amount: 8},
+        {Sender: "D", Receiver: "A", Token: "T", Amount: 8},
+        {Sender: "B", Receiver: "E", Token: "T", Amount: 3},
+        {Sender: "E", Receiver: "A", Token: "T", Amount: 3},
+        {Sender: "A", Receiver: "B", Token: "U", Amount: 1},
+    }
+    heuristic, err := ProcessNetting(intents)
+    if err != nil {
+        t.Fatal(err)
+    }
+    optimal, err := OptimalNetSingleToken(intents, "T")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if got, was := volume(optimal), volume(heuristic); got != 7 || was != 10 {
+        t.Errorf("optimal left %d and the heuristic %d, want 7 and 10", got, was)
+    }
+    if err := VerifyConservation(intents, optimal); err != nil {
+        t.Error(err)
+    }
+
+    r := rand.New(rand.NewSource(7))
+    for trial := 0; trial < 30; trial++ {
+        intents := randomIntents(r, 7, 1, 25)
+        heuristic, err := ProcessNetting(intents)
+        if err != nil {
+            t.Fatal(err)
+        }
+        optimal, err := OptimalNetSingleToken(intents, "t0")
+        if err != nil {
+            t.Fatal(err)
+        }
+        if volume(optimal) > volume(heuristic) {
+            t.Errorf("trial %d: optimal left %d, more than the heuristic's %d", trial, volume(optimal), volume(heuristic))
+        }
+        if err := VerifyConservation(intents, optimal); err != nil {
+            t.Errorf("trial %d: %v", trial, err)
+        }
+    }
+}
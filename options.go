@@ -0,0 +1,342 @@
+package netting
+
+import (
+    "fmt"
+    "math"
+    "sort"
+    "time"
+    "unsafe"
+)
+
+// DefaultMaxCycleLength is the cycle length limit used when
+// Options.MaxCycleLength is unset
+const DefaultMaxCycleLength = 4
+
+// CycleOrder decides the order in which the cycles of an SCC are netted.
+// Cycles overlap, so the order changes how much debt remains.
+type CycleOrder int
+
+const (
+    // ByDiscovery nets cycles in the order FindCycles reports them
+    ByDiscovery CycleOrder = iota
+    // ByAmountDesc nets the cycles that can offset the most first. Amounts
+    // are compared as found, before any netting in the SCC is applied.
+    ByAmountDesc
+    // ByLength nets the shortest cycles first
+    ByLength
+)
+
+// OptionsOf tunes ProcessNettingWithOptions and ProcessNettingOf for
+// participants identified by N. The zero value gives the same behavior as
+// ProcessNetting.
+type OptionsOf[N comparable] struct {
+    // MaxCycleLength is the longest cycle, in hops, that is considered for
+    // netting. Zero means DefaultMaxCycleLength; otherwise it must be at
+    // least 2. The cycle search only prunes as Johnson's algorithm does when
+    // it is at least the number of participants that owe anything; see
+    // FindCycles.
+    MaxCycleLength int
+
+    // MaxCycles caps how many cycles are enumerated per SCC of a token's
+    // edges, bounding time and memory on dense components. Once the cap is
+    // hit the remaining cycles of that SCC are not netted, so netting is
+    // only partial. Zero means no cap; negative values are rejected.
+    MaxCycles int
+
+    // MaxParticipants caps how many distinct participants one netting step
+    // may involve; cycles with more are skipped. Zero means no cap;
+    // otherwise it must be at least 2.
+    MaxParticipants int
+
+    // CycleOrder is the order cycles are netted in within each SCC
+    CycleOrder CycleOrder
+
+    // Fairness spreads netting across cycles that share edges instead of
+    // netting each in turn as far as it goes. Every cycle of an SCC is
+    // netted by half of what it can take, rounded up, in repeated passes
+    // until nothing more nets, so overlapping cycles split shared edges
+    // rather than the first taking all. Each cycle's total is reported as
+    // one step once its SCC is done. It does not apply with ShortestCycles.
+    Fairness bool
+
+    // ShortestCycles nets greedily instead of enumerating the cycles of each
+    // SCC: for every token and node in order, the shortest cycle through the
+    // node is found by breadth-first search and netted until none is left.
+    // This scales to SCCs too dense to enumerate. MaxCycles and CycleOrder
+    // do not apply. Without it, an SCC whose cycles would be too many to
+    // enumerate is settled on net positions, as OptimalNetSingleToken does,
+    // unless MaxCycles, a memory Budget or CycleFilter is set, and a warning
+    // is logged, to the standard logger if Logger is nil.
+    ShortestCycles bool
+
+    // MinRetain holds floors below which netting never lowers an edge, for
+    // example where the debt backs collateral. A floor above the edge's
+    // amount keeps the whole edge out of netting.
+    MinRetain map[EdgeKeyOf[N]]uint64
+
+    // CycleFilter, if set, is asked before each netting step is applied,
+    // mutual debts included, with the cycle, token and amount it would net;
+    // returning false skips the step and leaves the debts as they are. It is
+    // called synchronously and the slice is a copy it may keep. With
+    // Fairness it is asked once per cycle and token, about what the cycle
+    // can net before the halving passes, and it does not apply with
+    // ShortestCycles.
+    CycleFilter func(cycle []N, token string, amount uint64) bool
+
+    // CreditLimits caps how much a sender may owe a receiver in a token,
+    // modelling credit lines. Cycle netting never raises a debt, but one
+    // may start over its limit: netting a batch fails with an error
+    // wrapping ErrCreditLimit if any debt is still over once netted, and
+    // NettingEngine.AddIntent and RoundEngine.Round reject intents that
+    // would take a debt past its limit. OptimalNetSingleTokenWithLimits
+    // uses them as capacities. Pairs without an entry are unlimited.
+    CreditLimits map[EdgeKeyOf[N]]uint64
+
+    // MinNetAmount is the smallest amount worth netting around a cycle.
+    // Cycles that would net less, including mutual debts, are skipped and
+    // their debts left as they are. With Fairness it applies to what each
+    // cycle can net before the halving passes begin. Zero nets any amount.
+    MinNetAmount uint64
+
+    // ForbiddenPairs lists participants that must not be netted against each
+    // other. A cycle with a hop between the two of a pair, in either
+    // direction, is skipped, leaving its debts as they were.
+    ForbiddenPairs [][2]N
+
+    // MustSettle lists participants, such as exiting members, whose debts
+    // should be cleared even at the cost of netting less overall. Within
+    // each SCC cycles through any of them are netted before all others,
+    // keeping CycleOrder among each, and with ShortestCycles they are the
+    // first nodes searched from. Whatever they still owe or are owed is
+    // reported in Stats.Unsettled.
+    MustSettle []N
+
+    // Tokens, if not empty, lists the only tokens that are netted. Edges in
+    // any other token are passed through unchanged.
+    Tokens []string
+
+    // Now, if set, is the time intents are netted at. Intents whose
+    // ExpiresAt is at or before it are dropped before the graph is built, so
+    // only live intents are netted or returned. It applies to the
+    // ProcessNetting functions; the engines do not expire intents.
+    Now time.Time
+
+    // PreserveIntents returns residuals as the original intents rather than
+    // one intent per edge. Netting is charged to each edge's intents in the
+    // order they were given, so what remains of an edge is its latest
+    // intents, the earliest of which may be reduced, each keeping its ID and
+    // Refs. It applies to ProcessNettingWithOptions, ProcessNettingWithOps
+    // and ProcessNettingOf.
+    PreserveIntents bool
+
+    // IncludeZeroResiduals keeps debts that netted away entirely in the
+    // result with a zero Amount instead of dropping them, so every input
+    // edge, or with PreserveIntents every input intent, can be reconciled.
+    // It applies where PreserveIntents does.
+    IncludeZeroResiduals bool
+
+    // OnSCCFound and OnCycleFound, if set, are called synchronously as each
+    // SCC is about to be searched and as each cycle found in it is about to
+    // be considered, before any of its netting is applied. In ShortestCycles
+    // mode no SCCs are searched and each cycle is reported as it is found.
+    // The slices are copies the callback may keep.
+    OnSCCFound   func(scc []N)
+    OnCycleFound func(cycle []N)
+
+    // OnNetting, if set, is called with every netting step as it is applied:
+    // once per cycle and token that was actually netted, with the amount
+    // offset. Tokens of a cycle with nothing left to net are not reported.
+    OnNetting func(op NettingOpOf[N])
+
+    // Budget bounds the time and memory a run may use
+    Budget Budget
+
+    // Workers, if greater than 1, nets the tokens on up to that many
+    // goroutines. Each token's edges are netted on their own either way and
+    // the results merged in token order, so the outcome is the same.
+    // Negative values are rejected.
+    Workers int
+
+    // Logger, if set, receives debug messages for every SCC and cycle found
+    // and every netting step applied. Nil disables logging but for the
+    // warning about an SCC too dense to enumerate.
+    Logger Logger
+
+    // tokens is Tokens as a set and forbidden holds ForbiddenPairs in both
+    // orders, filled in by withDefaults
+    tokens    map[string]bool
+    forbidden map[[2]N]bool
+
+    // mustSettle is MustSettle as a set, filled in by withDefaults
+    mustSettle map[N]bool
+
+    // touched, if not nil, confines the cycle search to SCCs containing one
+    // of its nodes. Any new cycle runs through an edge that changed, so SCCs
+    // without a touched node are left as a complete netting run left them.
+    touched map[N]bool
+}
+
+// Logger is the destination for diagnostic messages. *log.Logger satisfies
+// it.
+type Logger interface {
+    Printf(format string, args ...any)
+}
+
+// Budget limits a netting run. When a limit is reached netting stops early,
+// keeps what it has netted and reports the run as truncated in Stats.
+type Budget struct {
+    // Time is the wall-clock limit for netting. Zero means none.
+    Time time.Duration
+
+    // Memory is a soft limit, in bytes, on the cycles held at once while
+    // netting an SCC. It is enforced by capping how many cycles are
+    // enumerated, using an estimate of their size. Zero means none.
+    Memory int64
+}
+
+// cycleOverhead estimates the bytes one enumerated cycle costs beyond its
+// nodes: its slice header and the netting candidates built from it
+const cycleOverhead = 96
+
+// cycleSize returns the size of one node of type N
+func cycleSize[N comparable]() int64 {
+    var zero N
+    return int64(unsafe.Sizeof(zero))
+}
+
+// cycles returns how many cycles of up to maxLength nodes, each nodeSize
+// bytes, fit in the memory budget. At least one is always allowed.
+func (b Budget) cycles(maxLength int, nodeSize int64) int {
+    n := b.Memory / (int64(maxLength)*nodeSize + cycleOverhead)
+    if n < 1 {
+        return 1
+    }
+    if n > math.MaxInt32 {
+        return math.MaxInt32
+    }
+    return int(n)
+}
+
+// Options is an OptionsOf for string participant identifiers
+type Options = OptionsOf[string]
+
+// withDefaults fills in unset fields and rejects invalid ones
+func (o OptionsOf[N]) withDefaults() (OptionsOf[N], error) {
+    if o.MaxCycleLength == 0 {
+        o.MaxCycleLength = DefaultMaxCycleLength
+    }
+    if o.MaxCycleLength < 2 {
+        return o, fmt.Errorf("max cycle length %d is less than 2", o.MaxCycleLength)
+    }
+    if o.CycleOrder < ByDiscovery || o.CycleOrder > ByLength {
+        return o, fmt.Errorf("unknown cycle order %d", o.CycleOrder)
+    }
+    if o.MaxCycles < 0 {
+        return o, fmt.Errorf("max cycles %d is negative", o.MaxCycles)
+    }
+    if o.MaxParticipants < 0 || o.MaxParticipants == 1 {
+        return o, fmt.Errorf("max participants %d is less than 2", o.MaxParticipants)
+    }
+    if o.Budget.Time < 0 || o.Budget.Memory < 0 {
+        return o, fmt.Errorf("budget %+v is negative", o.Budget)
+    }
+    if o.Workers < 0 {
+        return o, fmt.Errorf("workers %d is negative", o.Workers)
+    }
+    if len(o.Tokens) > 0 {
+        o.tokens = make(map[string]bool, len(o.Tokens))
+        for _, token := range o.Tokens {
+            o.tokens[token] = true
+        }
+    }
+    if len(o.ForbiddenPairs) > 0 {
+        o.forbidden = make(map[[2]N]bool, 2*len(o.ForbiddenPairs))
+        for _, pair := range o.ForbiddenPairs {
+            o.forbidden[pair] = true
+            o.forbidden[[2]N{pair[1], pair[0]}] = true
+        }
+    }
+    if len(o.MustSettle) > 0 {
+        o.mustSettle = make(map[N]bool, len(o.MustSettle))
+        for _, node := range o.MustSettle {
+            o.mustSettle[node] = true
+        }
+    }
+    return o, nil
+}
+
+// applied reports a netting step of a cycle to the Logger and OnNetting
+func (o OptionsOf[N]) applied(op NettingOpOf[N]) {
+    if o.Logger != nil {
+        o.Logger.Printf("netting: cycle %v netted %d %s", op.Cycle, op.Amount, op.Token)
+    }
+    if o.OnNetting != nil {
+        o.OnNetting(op)
+    }
+}
+
+// worth reports whether amount is enough to be netted
+func (o OptionsOf[N]) worth(amount uint64) bool {
+    return amount > 0 && amount >= o.MinNetAmount
+}
+
+// takes reports whether netting amount of token around cycle is allowed,
+// asking CycleFilter once the amount is found worth netting
+func (o OptionsOf[N]) takes(cycle []N, token string, amount uint64) bool {
+    if !o.worth(amount) {
+        return false
+    }
+    return o.CycleFilter == nil || o.CycleFilter(append([]N(nil), cycle...), token, amount)
+}
+
+// searches reports whether scc may hold a cycle not yet netted
+func (o OptionsOf[N]) searches(scc []N) bool {
+    if o.touched == nil {
+        return true
+    }
+    for _, node := range scc {
+        if o.touched[node] {
+            return true
+        }
+    }
+    return false
+}
+
+// involves reports whether cycle runs through a MustSettle participant
+func (o OptionsOf[N]) involves(cycle []N) bool {
+    for _, node := range cycle {
+        if o.mustSettle[node] {
+            return true
+        }
+    }
+    return false
+}
+
+// prioritize moves the candidates through a MustSettle participant ahead of
+// the rest, keeping their order otherwise
+func (o OptionsOf[N]) prioritize(candidates []candidate[N]) {
+    if o.mustSettle == nil {
+        return
+    }
+    sort.SliceStable(candidates, func(i, j int) bool {
+        return o.involves(candidates[i].cycle) && !o.involves(candidates[j].cycle)
+    })
+}
+
+// allows reports whether cycle has no hop between a forbidden pair
+func (o OptionsOf[N]) allows(cycle []N) bool {
+    if o.forbidden == nil {
+        return true
+    }
+    for i := range cycle {
+        if o.forbidden[[2]N{cycle[i], cycle[(i+1)%len(cycle)]}] {
+            return false
+        }
+    }
+    return true
+}
+
+// nets reports whether edges in token take part in netting
+func (o OptionsOf[N]) nets(token string) bool {
+    return o.tokens == nil || o.tokens[token]
+}
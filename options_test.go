@@ -0,0 +1,232 @@
+package netting
+
+import (
+    "fmt"
+    "math/rand"
+    "reflect"
+    "sort"
+    "testing"
+    "time"
+)
+
+func TestTokensFilter(t *testing.T) {
+    var intents []Intent
+    for _, token := range []string{"X", "Y", "Z"} {
+        intents = append(intents, triangle(token, 5)...)
+    }
+    out, err := ProcessNettingWithOptions(intents, Options{Tokens: []string{"X", "Z"}})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !IntentsEqual(out, triangle("Y", 5)) {
+        t.Errorf("residual = %v, want only the Y triangle", out)
+    }
+}
+
+func TestMaxParticipants(t *testing.T) {
+    ring := func(token string, nodes ...string) []Intent {
+        intents := make([]Intent, len(nodes))
+        for i, node := range nodes {
+            intents[i] = Intent{Sender: node, Receiver: nodes[(i+1)%len(nodes)], Token: token, Amount: 5}
+        }
+        return intents
+    }
+    five := ring("T", "A", "B", "C", "D", "E")
+    three := ring("T", "X", "Y", "Z")
+    out, err := ProcessNettingWithOptions(append(five, three...), Options{MaxCycleLength: 5, MaxParticipants: 4})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !IntentsEqual(out, five) {
+        t.Errorf("residual = %v, want the 5-party ring only", out)
+    }
+}
+
+func TestForbiddenPairs(t *testing.T) {
+    intents := append(triangle("T", 5), triangle("U", 5)...)
+    free, err := ProcessNetting(intents)
+    if err != nil {
+        t.Fatal(err)
+    }
+    // The pair is given the other way round from the A -> B hop, so only
+    // applying it in both directions skips the cycle
+    out, err := ProcessNettingWithOptions(intents, Options{ForbiddenPairs: [][2]string{{"B", "A"}}})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(free) != 0 {
+        t.Errorf("unconstrained residual = %v, want none", free)
+    }
+    if !IntentsEqual(out, intents) {
+        t.Errorf("residual = %v, want every debt untouched", out)
+    }
+}
+
+func TestTimeBudgetTruncates(t *testing.T) {
+    intents := randomIntents(rand.New(rand.NewSource(1)), 60, 1, 600)
+    full, stats, err := ProcessNettingWithStatsOptions(intents, Options{MaxCycleLength: 6})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if stats.Truncated {
+        t.Fatal("unbudgeted run was truncated")
+    }
+
+    // Mutual debts are netted before the budget is first checked, so even a
+    // budget spent at once nets something
+    out, stats, err := ProcessNettingWithStatsOptions(intents, Options{MaxCycleLength: 6, Budget: Budget{Time: time.Nanosecond}})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !stats.Truncated {
+        t.Error("budgeted run was not truncated")
+    }
+    if len(out) >= stats.IntentsBefore || len(out) <= len(full) {
+        t.Errorf("budgeted run left %d intents, want between the full run's %d and the %d given", len(out), len(full), stats.IntentsBefore)
+    }
+    if err := VerifyConservation(intents, out); err != nil {
+        t.Error(err)
+    }
+}
+
+func TestCallbackOrder(t *testing.T) {
+    var events []string
+    opts := Options{
+        OnSCCFound:   func(scc []string) { events = append(events, fmt.Sprintf("scc %d", len(scc))) },
+        OnCycleFound: func(cycle []string) { events = append(events, fmt.Sprint("cycle ", cycle)) },
+        OnNetting:    func(op NettingOp) { events = append(events, fmt.Sprintf("net %v %d", op.Cycle, op.Amount)) },
+    }
+    if _, err := ProcessNettingWithOptions(triangle("T", 5), opts); err != nil {
+        t.Fatal(err)
+    }
+    want := []string{"scc 3", "cycle [A B C]", "net [A B C] 5"}
+    if !reflect.DeepEqual(events, want) {
+        t.Errorf("callbacks = %q, want %q", events, want)
+    }
+
+    // Unset callbacks are skipped
+    if _, err := ProcessNettingWithOptions(triangle("T", 5), Options{OnNetting: opts.OnNetting}); err != nil {
+        t.Fatal(err)
+    }
+}
+
+func TestFairnessBalancesResiduals(t *testing.T) {
+    // Both cycles through A -> B can net all 10 of it; greedily one of them
+    // does and the other keeps its whole debt
+    intents := []Intent{
+        {Sender: "A", Receiver: "B", Token: "T", Amount: 10},
+        {Sender: "B", Receiver: "C", Token: "T", Amount: 10},
+        {Sender: "C", Receiver: "A", Token: "T", Amount: 10},
+        {Sender: "B", Receiver: "D", Token: "T", Amount: 10},
+        {Sender: "D", Receiver: "A", Token: "T", Amount: 10},
+    }
+    largest := func(intents []Intent) uint64 {
+        var most uint64
+        for _, intent := range intents {
+            most = max(most, intent.Amount)
+        }
+        return most
+    }
+
+    greedy, err := ProcessNetting(intents)
+    if err != nil {
+        t.Fatal(err)
+    }
+    fair, err := ProcessNettingWithOptions(intents, Options{Fairness: true})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if got := largest(greedy); got != 10 {
+        t.Errorf("greedy largest residual = %d, want 10", got)
+    }
+    if got := largest(fair); got != 6 {
+        t.Errorf("fair largest residual = %d, want 6 (residual %v)", got, fair)
+    }
+    if err := VerifyConservation(intents, fair); err != nil {
+        t.Error(err)
+    }
+}
+
+func TestMinNetAmount(t *testing.T) {
+    // The X triangle and the P, Q pair would net 2 and 3, below the minimum
+    small := append(triangle("X", 2),
+        Intent{Sender: "P", Receiver: "Q", Token: "X", Amount: 3},
+        Intent{Sender: "Q", Receiver: "P", Token: "X", Amount: 8},
+    )
+    intents := append(triangle("Y", 50), small...)
+    out, err := ProcessNettingWithOptions(intents, Options{MinNetAmount: 10})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !IntentsEqual(out, small) {
+        t.Errorf("residual = %v, want the small debts left as they were", out)
+    }
+}
+
+func TestCycleFilterEvenLength(t *testing.T) {
+    odd := triangle("T", 5)
+    intents := append(odd,
+        Intent{Sender: "P", Receiver: "Q", Token: "T", Amount: 5},
+        Intent{Sender: "Q", Receiver: "R", Token: "T", Amount: 5},
+        Intent{Sender: "R", Receiver: "S", Token: "T", Amount: 5},
+        Intent{Sender: "S", Receiver: "P", Token: "T", Amount: 5},
+        Intent{Sender: "X", Receiver: "Y", Token: "T", Amount: 5},
+        Intent{Sender: "Y", Receiver: "X", Token: "T", Amount: 5},
+    )
+    var lengths []int
+    even := func(cycle []string, token string, amount uint64) bool {
+        lengths = append(lengths, len(cycle))
+        return len(cycle)%2 == 0
+    }
+    out, err := ProcessNettingWithOptions(intents, Options{CycleFilter: even})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !IntentsEqual(out, odd) {
+        t.Errorf("residual = %v, want only the triangle", out)
+    }
+    sort.Ints(lengths)
+    if !reflect.DeepEqual(lengths, []int{2, 3, 4}) {
+        t.Errorf("filter saw cycles of lengths %v, want 2, 3 and 4", lengths)
+    }
+}
+
+func TestMustSettleChangesCycle(t *testing.T) {
+    // Two triangles share a -> b, which only one of them can net
+    intents := []Intent{
+        {Sender: "a", Receiver: "b", Token: "T", Amount: 10},
+        {Sender: "b", Receiver: "c", Token: "T", Amount: 10},
+        {Sender: "c", Receiver: "a", Token: "T", Amount: 10},
+        {Sender: "b", Receiver: "x", Token: "T", Amount: 10},
+        {Sender: "x", Receiver: "a", Token: "T", Amount: 10},
+    }
+    viaC, viaX := intents[1:3], intents[3:]
+
+    out, err := ProcessNetting(intents)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !IntentsEqual(out, viaC) {
+        t.Fatalf("default residual = %v, want the triangle through c", out)
+    }
+
+    out, stats, err := ProcessNettingWithStatsOptions(intents, Options{MustSettle: []string{"c"}})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !IntentsEqual(out, viaX) {
+        t.Errorf("residual settling c = %v, want the triangle through x", out)
+    }
+    if len(stats.Unsettled) != 0 {
+        t.Errorf("Unsettled = %v, want c cleared", stats.Unsettled)
+    }
+
+    // b is in both triangles, so one of its debts is left over
+    _, stats, err = ProcessNettingWithStatsOptions(intents, Options{MustSettle: []string{"b"}})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !IntentsEqual(stats.Unsettled, intents[1:2]) {
+        t.Errorf("Unsettled = %v, want b -> c", stats.Unsettled)
+    }
+}
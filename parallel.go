@@ -0,0 +1,135 @@
+package netting
+
+import (
+    "context"
+    "sort"
+    "sync"
+)
+
+// lockedLogger serializes calls to a Logger shared by several workers
+type lockedLogger struct {
+    mu     *sync.Mutex
+    logger Logger
+}
+
+func (l lockedLogger) Printf(format string, args ...any) {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    l.logger.Printf(format, args...)
+}
+
+// mixesTokens reports whether g has edges in more than one token
+func (g *GraphOf[N]) mixesTokens() bool {
+    seen, token := false, ""
+    for _, edges := range g.Edges {
+        for _, edge := range edges {
+            if seen && edge.Token != token {
+                return true
+            }
+            seen, token = true, edge.Token
+        }
+    }
+    return false
+}
+
+// netByToken is netAll with the graph split by token. Tokens never net
+// against each other, so each token's subgraph is netted on its own, by a
+// pool of opts.Workers goroutines if that is above 1, and the results are
+// merged in token order. The subgraphs are merged back even if one fails,
+// so on error g is partially netted as with netAll.
+func (g *GraphOf[N]) netByToken(ctx context.Context, opts OptionsOf[N]) ([]NettingOpOf[N], bool, error) {
+    subs := g.SplitByToken()
+    tokens := make([]string, 0, len(subs))
+    for token := range subs {
+        tokens = append(tokens, token)
+    }
+    sort.Strings(tokens)
+
+    // Each subgraph is netted sequentially; callbacks are serialized so
+    // they need not be safe for concurrent use
+    var mu sync.Mutex
+    seq := opts
+    seq.Workers = 0
+    if opts.Logger != nil {
+        seq.Logger = lockedLogger{mu: &mu, logger: opts.Logger}
+    }
+    if opts.OnSCCFound != nil {
+        seq.OnSCCFound = func(scc []N) {
+            mu.Lock()
+            defer mu.Unlock()
+            opts.OnSCCFound(scc)
+        }
+    }
+    if opts.OnCycleFound != nil {
+        seq.OnCycleFound = func(cycle []N) {
+            mu.Lock()
+            defer mu.Unlock()
+            opts.OnCycleFound(cycle)
+        }
+    }
+    if opts.OnNetting != nil {
+        seq.OnNetting = func(op NettingOpOf[N]) {
+            mu.Lock()
+            defer mu.Unlock()
+            opts.OnNetting(op)
+        }
+    }
+    if opts.CycleFilter != nil {
+        seq.CycleFilter = func(cycle []N, token string, amount uint64) bool {
+            mu.Lock()
+            defer mu.Unlock()
+            return opts.CycleFilter(cycle, token, amount)
+        }
+    }
+
+    results := make([][]NettingOpOf[N], len(tokens))
+    truncated := make([]bool, len(tokens))
+    errs := make([]error, len(tokens))
+    if opts.Workers <= 1 {
+        for i, token := range tokens {
+            results[i], truncated[i], errs[i] = subs[token].netAll(ctx, seq)
+        }
+        return g.mergeTokens(subs, tokens, results, truncated, errs)
+    }
+    next := make(chan int)
+    var wg sync.WaitGroup
+    for w := 0; w < opts.Workers && w < len(tokens); w++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for i := range next {
+                results[i], truncated[i], errs[i] = subs[tokens[i]].netAll(ctx, seq)
+            }
+        }()
+    }
+    for i := range tokens {
+        next <- i
+    }
+    close(next)
+    wg.Wait()
+    return g.mergeTokens(subs, tokens, results, truncated, errs)
+}
+
+// mergeTokens rebuilds g from the subgraphs netByToken netted, in token
+// order, and combines their results
+func (g *GraphOf[N]) mergeTokens(subs map[string]*GraphOf[N], tokens []string, results [][]NettingOpOf[N], truncated []bool, errs []error) ([]NettingOpOf[N], bool, error) {
+    g.Reset()
+    ops := make([]NettingOpOf[N], 0)
+    anyTruncated := false
+    var firstErr error
+    for i, token := range tokens {
+        sub := subs[token]
+        for _, from := range sub.sources() {
+            for _, edge := range sub.Edges[from] {
+                // Edges were distinct in g, so this cannot overflow
+                g.addEdge(from, edge.To, edge.Token, edge.Amount, edge.Refs)
+            }
+        }
+        ops = append(ops, results[i]...)
+        anyTruncated = anyTruncated || truncated[i]
+        if firstErr == nil {
+            firstErr = errs[i]
+        }
+    }
+    return ops, anyTruncated, firstErr
+}
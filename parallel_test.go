@@ -0,0 +1,68 @@
+package netting
+
+import (
+    "fmt"
+    "math/rand"
+    "sync"
+    "testing"
+)
+
+// Run with -race to check the workers share nothing unsynchronized
+func TestWorkersTenTokens(t *testing.T) {
+    r := rand.New(rand.NewSource(5))
+    for trial := 0; trial < 20; trial++ {
+        intents := randomIntents(r, 12, 10, 300)
+
+        // Callbacks are serialized, so they need no locking of their own
+        var ops []NettingOp
+        seen := make(map[string]bool)
+        opts := Options{
+            Workers:    4,
+            OnNetting:  func(op NettingOp) { ops = append(ops, op) },
+            OnSCCFound: func(scc []string) { seen[fmt.Sprint(scc)] = true },
+        }
+        got, err := ProcessNettingWithOptions(intents, opts)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if err := VerifyConservation(intents, got); err != nil {
+            t.Fatal(err)
+        }
+
+        // Each token is netted as if on its own
+        var want []Intent
+        for k := 0; k < 10; k++ {
+            residual, err := NetToken(intents, fmt.Sprintf("t%d", k))
+            if err != nil {
+                t.Fatal(err)
+            }
+            want = append(want, residual...)
+        }
+        if !IntentsEqual(got, want) {
+            t.Fatalf("trial %d: Workers 4 left %v, per-token netting %v", trial, got, want)
+        }
+        if len(ops) == 0 || len(seen) == 0 {
+            t.Errorf("trial %d: %d ops and %d SCCs reported", trial, len(ops), len(seen))
+        }
+    }
+}
+
+func TestWorkersConcurrentCalls(t *testing.T) {
+    intents := randomIntents(rand.New(rand.NewSource(6)), 12, 10, 300)
+    want, err := ProcessNettingWithOptions(intents, Options{Workers: 4})
+    if err != nil {
+        t.Fatal(err)
+    }
+    var wg sync.WaitGroup
+    for i := 0; i < 4; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            got, err := ProcessNettingWithOptions(intents, Options{Workers: 4})
+            if err != nil || !IntentsEqual(got, want) {
+                t.Errorf("concurrent run = %v, %v", got, err)
+            }
+        }()
+    }
+    wg.Wait()
+}
@@ -0,0 +1,174 @@
+package netting
+
+import "sort"
+
+// TransferStepOf is one transfer in a settlement plan. A participant is
+// assumed to pay only out of what it has been paid in the same token, so a
+// transfer depends on every transfer into its sender. Transfers whose
+// dependencies run in a cycle cannot be ordered and share an atomic Group
+// that must execute simultaneously, such as through an atomic batch or
+// simply by being offset.
+type TransferStepOf[N comparable] struct {
+    Transfer IntentOf[N] `json:"transfer"`
+
+    // Group numbers the steps that execute together, in execution order.
+    // Atomic is set on every step of a group of more than one.
+    Group  int  `json:"group"`
+    Atomic bool `json:"atomic,omitempty"`
+
+    // DependsOn indexes the earlier steps of the plan, outside the step's
+    // own group, that must complete before it
+    DependsOn []int `json:"depends_on,omitempty"`
+}
+
+// TransferStep is a TransferStepOf with string participant identifiers
+type TransferStep = TransferStepOf[string]
+
+// Transfers returns the transfers the step offsets, one per hop of Cycle.
+// Executing them is the settlement the step avoids, and every one depends on
+// another, so TransferPlan puts them in a single atomic group.
+func (op NettingOpOf[N]) Transfers() []IntentOf[N] {
+    transfers := make([]IntentOf[N], len(op.Cycle))
+    for i, from := range op.Cycle {
+        transfers[i] = IntentOf[N]{
+            Sender:   from,
+            Receiver: op.Cycle[(i+1)%len(op.Cycle)],
+            Token:    op.Token,
+            Amount:   op.Amount,
+        }
+    }
+    return transfers
+}
+
+// PlanTransfers accumulates transfers into a graph as netting would and
+// returns its TransferPlan
+func PlanTransfers(transfers []Intent) ([]TransferStep, error) {
+    g, _, err := buildGraph(transfers)
+    if err != nil {
+        return nil, err
+    }
+    return g.TransferPlan(), nil
+}
+
+// TransferPlan returns the edges of g as transfers in an order they can be
+// executed in. Each token is planned on its own, in sorted order. Edges
+// within an SCC of the token's subgraph depend on each other in a cycle and
+// form one atomic group; the groups are then ordered so that every transfer
+// into a participant precedes those out of it, ties going to the group whose
+// first transfer sorts first. On a graph netted to completion the only
+// atomic groups are cycles longer than the netting allowed.
+func (g *GraphOf[N]) TransferPlan() []TransferStepOf[N] {
+    subs := g.SplitByToken()
+    tokens := make([]string, 0, len(subs))
+    for token := range subs {
+        tokens = append(tokens, token)
+    }
+    sort.Strings(tokens)
+
+    steps := make([]TransferStepOf[N], 0)
+    for _, token := range tokens {
+        steps = subs[token].planToken(steps)
+    }
+    return steps
+}
+
+// planToken appends the plan for g, whose edges are all in one token, to
+// steps, numbering its groups after those already there
+func (g *GraphOf[N]) planToken(steps []TransferStepOf[N]) []TransferStepOf[N] {
+    comp := make(map[N]int)
+    for i, scc := range g.FindSCCs() {
+        for _, node := range scc {
+            comp[node] = i + 1
+        }
+    }
+
+    // Group the transfers; edges within an SCC share its group and any
+    // other edge is a group of its own
+    transfers := g.ToIntents()
+    var groups [][]int
+    ofSCC := make(map[int]int)
+    groupOf := make([]int, len(transfers))
+    for i, t := range transfers {
+        c := comp[t.Sender]
+        if c == 0 || c != comp[t.Receiver] {
+            groupOf[i] = len(groups)
+            groups = append(groups, []int{i})
+            continue
+        }
+        k, ok := ofSCC[c]
+        if !ok {
+            k = len(groups)
+            ofSCC[c] = k
+            groups = append(groups, nil)
+        }
+        groupOf[i] = k
+        groups[k] = append(groups[k], i)
+    }
+
+    // A transfer out of a node waits for every transfer into it
+    into := make(map[N][]int)
+    for i, t := range transfers {
+        into[t.Receiver] = append(into[t.Receiver], i)
+    }
+    waits := make([]int, len(groups))
+    after := make([][]int, len(groups))
+    for k, members := range groups {
+        seen := make(map[int]bool)
+        for _, i := range members {
+            for _, j := range into[transfers[i].Sender] {
+                if d := groupOf[j]; d != k && !seen[d] {
+                    seen[d] = true
+                    waits[k]++
+                    after[d] = append(after[d], k)
+                }
+            }
+        }
+    }
+
+    // Kahn's algorithm over the groups, which form a DAG. Groups are
+    // numbered in transfer order, so the smallest ready one goes first.
+    ready := make([]int, 0)
+    for k := range groups {
+        if waits[k] == 0 {
+            ready = append(ready, k)
+        }
+    }
+    position := make([]int, len(transfers))
+    next := 0
+    if len(steps) > 0 {
+        next = steps[len(steps)-1].Group + 1
+    }
+    for len(ready) > 0 {
+        sort.Ints(ready)
+        k := ready[0]
+        ready = ready[1:]
+
+        for _, i := range groups[k] {
+            position[i] = len(steps)
+            steps = append(steps, TransferStepOf[N]{
+                Transfer: transfers[i],
+                Group:    next,
+                Atomic:   len(groups[k]) > 1,
+            })
+        }
+        next++
+        for _, d := range after[k] {
+            waits[d]--
+            if waits[d] == 0 {
+                ready = append(ready, d)
+            }
+        }
+    }
+
+    // Dependencies are all placed by now
+    for i, t := range transfers {
+        step := &steps[position[i]]
+        for _, j := range into[t.Sender] {
+            if groupOf[j] != groupOf[i] {
+                step.DependsOn = append(step.DependsOn, position[j])
+            }
+        }
+        sort.Ints(step.DependsOn)
+    }
+    return steps
+}
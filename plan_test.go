@@ -0,0 +1,42 @@
+package netting
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestTransferPlan(t *testing.T) {
+    // A 5-party ring, too long to net by default, and a chain
+    ring := []Intent{
+        {Sender: "A", Receiver: "B", Token: "T", Amount: 5},
+        {Sender: "B", Receiver: "C", Token: "T", Amount: 5},
+        {Sender: "C", Receiver: "D", Token: "T", Amount: 5},
+        {Sender: "D", Receiver: "E", Token: "T", Amount: 5},
+        {Sender: "E", Receiver: "A", Token: "T", Amount: 5},
+    }
+    chain := []Intent{
+        {Sender: "P", Receiver: "Q", Token: "T", Amount: 3},
+        {Sender: "Q", Receiver: "R", Token: "T", Amount: 2},
+    }
+    netted, err := ProcessNetting(append(append([]Intent(nil), ring...), chain...))
+    if err != nil {
+        t.Fatal(err)
+    }
+    steps, err := PlanTransfers(netted)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    var want []TransferStep
+    for _, transfer := range ring {
+        want = append(want, TransferStep{Transfer: transfer, Group: 0, Atomic: true})
+    }
+    // Q can only pay R once P has paid Q
+    want = append(want,
+        TransferStep{Transfer: chain[0], Group: 1},
+        TransferStep{Transfer: chain[1], Group: 2, DependsOn: []int{5}},
+    )
+    if !reflect.DeepEqual(steps, want) {
+        t.Errorf("plan = %+v, want %+v", steps, want)
+    }
+}
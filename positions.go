@@ -0,0 +1,203 @@
+package netting
+
+import (
+    "errors"
+    "fmt"
+    "math"
+    "sort"
+    "strings"
+)
+
+// ErrPositionOverflow is returned when a net position does not fit in an
+// int64
+var ErrPositionOverflow = errors.New("net position overflows int64")
+
+// addPosition returns pos + amount for incoming and pos - amount for
+// outgoing debts, or false if the result leaves the int64 range
+func addPosition(pos int64, amount uint64, incoming bool) (int64, bool) {
+    if incoming {
+        if pos < 0 {
+            // Cancel the negative part first; its magnitude may be 2^63
+            magnitude := uint64(-(pos + 1)) + 1
+            if amount < magnitude {
+                return pos + int64(amount), true
+            }
+            amount -= magnitude
+            pos = 0
+        }
+        if amount > uint64(math.MaxInt64-pos) {
+            return 0, false
+        }
+        return pos + int64(amount), true
+    }
+
+    if pos > 0 {
+        if amount <= uint64(pos) {
+            return pos - int64(amount), true
+        }
+        amount -= uint64(pos)
+        pos = 0
+    }
+    // pos is now in [MinInt64, 0], so the room left is pos + 2^63
+    if amount > uint64(pos)+1<<63 {
+        return 0, false
+    }
+    // Wrapping arithmetic gives the right answer since the result is in range
+    return pos - int64(amount), true
+}
+
+// NetPositions returns, for every node and token, the sum of incoming minus
+// outgoing amounts. A positive position means the node is owed value. Every
+// node and token that appears on an edge is present, even if its position is
+// zero. ErrPositionOverflow is returned if a position leaves the int64 range.
+func (g *GraphOf[N]) NetPositions() (map[N]map[string]int64, error) {
+    positions := make(map[N]map[string]int64)
+
+    update := func(node N, token string, amount uint64, incoming bool) error {
+        if positions[node] == nil {
+            positions[node] = make(map[string]int64)
+        }
+        pos, ok := addPosition(positions[node][token], amount, incoming)
+        if !ok {
+            return fmt.Errorf("%s position of %v: %w", token, node, ErrPositionOverflow)
+        }
+        positions[node][token] = pos
+        return nil
+    }
+
+    for _, from := range g.sources() {
+        for _, edge := range g.Edges[from] {
+            if err := update(from, edge.Token, edge.Amount, false); err != nil {
+                return nil, err
+            }
+            if err := update(edge.To, edge.Token, edge.Amount, true); err != nil {
+                return nil, err
+            }
+        }
+    }
+
+    return positions, nil
+}
+
+// ErrNotConserved is returned by VerifyConservation when netting changed
+// some net position
+var ErrNotConserved = errors.New("net positions not conserved")
+
+// intentPositions is NetPositions for a list of intents. Self-loops leave
+// positions unchanged and are skipped.
+func intentPositions(intents []Intent) (map[string]map[string]int64, error) {
+    positions := make(map[string]map[string]int64)
+
+    update := func(node, token string, amount uint64, incoming bool) error {
+        if positions[node] == nil {
+            positions[node] = make(map[string]int64)
+        }
+        pos, ok := addPosition(positions[node][token], amount, incoming)
+        if !ok {
+            return fmt.Errorf("%s position of %s: %w", token, node, ErrPositionOverflow)
+        }
+        positions[node][token] = pos
+        return nil
+    }
+
+    for _, intent := range intents {
+        if intent.Sender == intent.Receiver {
+            continue
+        }
+        // A reversal moves positions as a debt the other way would
+        if err := update(intent.Sender, intent.Token, intent.Amount, intent.Reverse); err != nil {
+            return nil, err
+        }
+        if err := update(intent.Receiver, intent.Token, intent.Amount, !intent.Reverse); err != nil {
+            return nil, err
+        }
+    }
+    return positions, nil
+}
+
+// VerifyConservation checks that after leaves every participant with the
+// same net position per token as before, as netting must. Any differences
+// are listed, sorted by node and token, in an error wrapping
+// ErrNotConserved.
+func VerifyConservation(before, after []Intent) error {
+    was, err := intentPositions(before)
+    if err != nil {
+        return fmt.Errorf("before: %w", err)
+    }
+    now, err := intentPositions(after)
+    if err != nil {
+        return fmt.Errorf("after: %w", err)
+    }
+
+    // Collect every node and token seen on either side
+    keys := make(map[[2]string]bool)
+    for _, positions := range []map[string]map[string]int64{was, now} {
+        for node, tokens := range positions {
+            for token := range tokens {
+                keys[[2]string{node, token}] = true
+            }
+        }
+    }
+    sorted := make([][2]string, 0, len(keys))
+    for key := range keys {
+        sorted = append(sorted, key)
+    }
+    sort.Slice(sorted, func(i, j int) bool {
+        if sorted[i][0] != sorted[j][0] {
+            return sorted[i][0] < sorted[j][0]
+        }
+        return sorted[i][1] < sorted[j][1]
+    })
+
+    var diffs []string
+    for _, key := range sorted {
+        node, token := key[0], key[1]
+        if a, b := was[node][token], now[node][token]; a != b {
+            diffs = append(diffs, fmt.Sprintf("%s %s: %d before, %d after", node, token, a, b))
+        }
+    }
+    if len(diffs) > 0 {
+        return fmt.Errorf("%w: %s", ErrNotConserved, strings.Join(diffs, "; "))
+    }
+    return nil
+}
+
+// ErrDebtIncreased is returned by ValidateSettlement when a proposed debt is
+// larger than what was originally owed between the same parties in the same
+// direction
+var ErrDebtIncreased = errors.New("debt increased")
+
+// ValidateSettlement checks that proposed is a netting of original that
+// could have been reached by offsetting debts alone: net positions are
+// conserved, as VerifyConservation checks, and no sender owes any receiver
+// more of a token than it did originally. A debt between parties who owed
+// nothing in that direction, including one that reverses an original
+// debt, counts as an increase. Intents are validated and merged per edge as
+// for ProcessNetting. Every increase is listed, sorted by sender, in an
+// error wrapping ErrDebtIncreased.
+func ValidateSettlement(original, proposed []Intent) error {
+    was, _, err := buildGraph(original)
+    if err != nil {
+        return fmt.Errorf("original: %w", err)
+    }
+    now, _, err := buildGraph(proposed)
+    if err != nil {
+        return fmt.Errorf("proposed: %w", err)
+    }
+    if err := VerifyConservation(original, proposed); err != nil {
+        return err
+    }
+
+    var increases []string
+    for _, from := range now.sources() {
+        for _, edge := range now.Edges[from] {
+            if owed, _ := was.GetEdge(from, edge.To, edge.Token); edge.Amount > owed {
+                increases = append(increases, fmt.Sprintf("%s -> %s %s: %d originally, %d proposed", from, edge.To, edge.Token, owed, edge.Amount))
+            }
+        }
+    }
+    if len(increases) > 0 {
+        return fmt.Errorf("%w: %s", ErrDebtIncreased, strings.Join(increases, "; "))
+    }
+    return nil
+}
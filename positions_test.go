@@ -0,0 +1,69 @@
+package netting
+
+import (
+    "errors"
+    "math/rand"
+    "testing"
+)
+
+func TestVerifyConservation(t *testing.T) {
+    r := rand.New(rand.NewSource(3))
+    for trial := 0; trial < 20; trial++ {
+        intents := randomIntents(r, 8, 2, 50)
+        out, err := ProcessNetting(intents)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if err := VerifyConservation(intents, out); err != nil {
+            t.Errorf("trial %d: %v", trial, err)
+        }
+    }
+}
+
+func TestVerifyConservationCorrupted(t *testing.T) {
+    intents := append(triangle("T", 5), Intent{Sender: "A", Receiver: "B", Token: "T", Amount: 3})
+    out, err := ProcessNetting(intents)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(out) != 1 {
+        t.Fatalf("residual = %v, want A -> B 3", out)
+    }
+
+    out[0].Amount++
+    if err := VerifyConservation(intents, out); !errors.Is(err, ErrNotConserved) {
+        t.Errorf("VerifyConservation = %v, want ErrNotConserved", err)
+    }
+    if err := VerifyConservation(intents, nil); !errors.Is(err, ErrNotConserved) {
+        t.Errorf("VerifyConservation with debts dropped = %v, want ErrNotConserved", err)
+    }
+}
+
+func TestValidateSettlement(t *testing.T) {
+    original := append(triangle("T", 5), Intent{Sender: "A", Receiver: "B", Token: "T", Amount: 3})
+    netted, err := ProcessNetting(original)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := ValidateSettlement(original, netted); err != nil {
+        t.Errorf("ValidateSettlement(netted) = %v", err)
+    }
+
+    // Positions still balance, but C and D owe each other out of nowhere
+    invented := append(append([]Intent(nil), netted...),
+        Intent{Sender: "C", Receiver: "D", Token: "T", Amount: 4},
+        Intent{Sender: "D", Receiver: "C", Token: "T", Amount: 4},
+    )
+    if err := ValidateSettlement(original, invented); !errors.Is(err, ErrDebtIncreased) {
+        t.Errorf("ValidateSettlement(invented) = %v, want ErrDebtIncreased", err)
+    }
+
+    // The 3 A still owes B turned around
+    if !IntentsEqual(netted, []Intent{{Sender: "A", Receiver: "B", Token: "T", Amount: 3}}) {
+        t.Fatalf("netted = %v", netted)
+    }
+    reversed := []Intent{{Sender: "B", Receiver: "A", Token: "T", Amount: 3}}
+    if err := ValidateSettlement(original, reversed); err == nil {
+        t.Error("ValidateSettlement accepted a reversed debt")
+    }
+}
@@ -0,0 +1,208 @@
+package netting
+
+import (
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "time"
+    "unicode/utf8"
+)
+
+// ErrMalformedProto is returned when protobuf input cannot be decoded
+var ErrMalformedProto = errors.New("malformed protobuf")
+
+// Protobuf wire types used by proto/netting.proto
+const (
+    wireVarint  = 0
+    wireFixed64 = 1
+    wireBytes   = 2
+    wireFixed32 = 5
+)
+
+// appendTag appends the key of field with the given wire type
+func appendTag(b []byte, field, wire int) []byte {
+    return binary.AppendUvarint(b, uint64(field)<<3|uint64(wire))
+}
+
+// appendString appends s as field, omitting it if empty as proto3 does
+func appendString(b []byte, field int, s string) []byte {
+    if s == "" {
+        return b
+    }
+    b = appendTag(b, field, wireBytes)
+    b = binary.AppendUvarint(b, uint64(len(s)))
+    return append(b, s...)
+}
+
+// appendVarint appends v as field, omitting it if zero as proto3 does
+func appendVarint(b []byte, field int, v uint64) []byte {
+    if v == 0 {
+        return b
+    }
+    b = appendTag(b, field, wireVarint)
+    return binary.AppendUvarint(b, v)
+}
+
+// appendIntent appends the netting.v1.Intent encoding of intent
+func appendIntent(b []byte, intent Intent) []byte {
+    b = appendString(b, 1, intent.Sender)
+    b = appendString(b, 2, intent.Receiver)
+    b = appendString(b, 3, intent.Token)
+    b = appendVarint(b, 4, intent.Amount)
+    b = appendString(b, 5, intent.ID)
+    for _, ref := range intent.Refs {
+        // Repeated strings are written even when empty, so none is lost
+        b = appendTag(b, 6, wireBytes)
+        b = binary.AppendUvarint(b, uint64(len(ref)))
+        b = append(b, ref...)
+    }
+    if intent.Reverse {
+        b = appendVarint(b, 7, 1)
+    }
+    if !intent.ExpiresAt.IsZero() {
+        // int64 varints carry the two's complement bits
+        b = appendVarint(b, 8, uint64(intent.ExpiresAt.UnixNano()))
+    }
+    return b
+}
+
+// IntentsToProto encodes intents as a netting.v1.IntentBatch message, the
+// wire format of proto/netting.proto, without needing generated code.
+// ExpiresAt is sent in Unix nanoseconds, so times outside the years 1678 to
+// 2262 do not survive the trip.
+func IntentsToProto(intents []Intent) []byte {
+    b := make([]byte, 0)
+    for _, intent := range intents {
+        msg := appendIntent(nil, intent)
+        b = appendTag(b, 1, wireBytes)
+        b = binary.AppendUvarint(b, uint64(len(msg)))
+        b = append(b, msg...)
+    }
+    return b
+}
+
+// protoField is one decoded field of a message. v holds a varint or fixed
+// value and data the contents of a length-delimited field.
+type protoField struct {
+    num, wire int
+    v         uint64
+    data      []byte
+}
+
+// nextField decodes the field at the start of b and returns the rest of b
+func nextField(b []byte) (protoField, []byte, error) {
+    key, n := binary.Uvarint(b)
+    if n <= 0 {
+        return protoField{}, nil, fmt.Errorf("field key: %w", ErrMalformedProto)
+    }
+    if key>>3 == 0 || key>>3 > 1<<29-1 {
+        return protoField{}, nil, fmt.Errorf("field number %d: %w", key>>3, ErrMalformedProto)
+    }
+    b = b[n:]
+    f := protoField{num: int(key >> 3), wire: int(key & 7)}
+
+    switch f.wire {
+    case wireVarint:
+        if f.v, n = binary.Uvarint(b); n <= 0 {
+            return protoField{}, nil, fmt.Errorf("field %d varint: %w", f.num, ErrMalformedProto)
+        }
+        return f, b[n:], nil
+    case wireFixed64:
+        if len(b) < 8 {
+            return protoField{}, nil, fmt.Errorf("field %d fixed64: %w", f.num, ErrMalformedProto)
+        }
+        f.v = binary.LittleEndian.Uint64(b)
+        return f, b[8:], nil
+    case wireFixed32:
+        if len(b) < 4 {
+            return protoField{}, nil, fmt.Errorf("field %d fixed32: %w", f.num, ErrMalformedProto)
+        }
+        f.v = uint64(binary.LittleEndian.Uint32(b))
+        return f, b[4:], nil
+    case wireBytes:
+        size, n := binary.Uvarint(b)
+        if n <= 0 || size > uint64(len(b)-n) {
+            return protoField{}, nil, fmt.Errorf("field %d length: %w", f.num, ErrMalformedProto)
+        }
+        b = b[n:]
+        f.data = b[:size]
+        return f, b[size:], nil
+    }
+    return protoField{}, nil, fmt.Errorf("field %d wire type %d: %w", f.num, f.wire, ErrMalformedProto)
+}
+
+// decodeIntent decodes a netting.v1.Intent message. Unknown fields are
+// skipped, so newer senders can add fields.
+func decodeIntent(b []byte) (Intent, error) {
+    var intent Intent
+    for len(b) > 0 {
+        f, rest, err := nextField(b)
+        if err != nil {
+            return Intent{}, err
+        }
+        b = rest
+
+        if f.num > 8 {
+            continue
+        }
+        want := wireBytes
+        if f.num == 4 || f.num == 7 || f.num == 8 {
+            want = wireVarint
+        }
+        if f.wire != want {
+            return Intent{}, fmt.Errorf("field %d wire type %d: %w", f.num, f.wire, ErrMalformedProto)
+        }
+        if want == wireBytes && !utf8.Valid(f.data) {
+            return Intent{}, fmt.Errorf("field %d is not UTF-8: %w", f.num, ErrMalformedProto)
+        }
+
+        switch f.num {
+        case 1:
+            intent.Sender = string(f.data)
+        case 2:
+            intent.Receiver = string(f.data)
+        case 3:
+            intent.Token = string(f.data)
+        case 4:
+            intent.Amount = f.v
+        case 5:
+            intent.ID = string(f.data)
+        case 6:
+            intent.Refs = append(intent.Refs, string(f.data))
+        case 7:
+            intent.Reverse = f.v != 0
+        case 8:
+            intent.ExpiresAt = time.Time{}
+            if f.v != 0 {
+                intent.ExpiresAt = time.Unix(0, int64(f.v)).UTC()
+            }
+        }
+    }
+    return intent, nil
+}
+
+// IntentsFromProto decodes a netting.v1.IntentBatch message written by
+// IntentsToProto or any protobuf implementation. Expiry times come back in
+// UTC. The intents are not validated; ProcessNetting does that.
+func IntentsFromProto(data []byte) ([]Intent, error) {
+    intents := make([]Intent, 0)
+    for len(data) > 0 {
+        f, rest, err := nextField(data)
+        if err != nil {
+            return nil, err
+        }
+        data = rest
+        if f.num != 1 {
+            continue
+        }
+        if f.wire != wireBytes {
+            return nil, fmt.Errorf("field 1 wire type %d: %w", f.wire, ErrMalformedProto)
+        }
+        intent, err := decodeIntent(f.data)
+        if err != nil {
+            return nil, fmt.Errorf("intent %d: %w", len(intents), err)
+        }
+        intents = append(intents, intent)
+    }
+    return intents, nil
+}
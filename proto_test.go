@@ -0,0 +1,128 @@
+package netting
+
+import (
+    "bytes"
+    "errors"
+    "math"
+    "reflect"
+    "testing"
+    "time"
+)
+
+func TestIntentsProtoRoundTrip(t *testing.T) {
+    intents := []Intent{
+        {Sender: "A", Receiver: "B", Token: "T", Amount: 10, ID: "tx1"},
+        {Sender: "B", Receiver: "A", Token: "T", Amount: math.MaxUint64, Refs: []string{"tx1", "", "tx3"}},
+        {Sender: "A", Receiver: "B", Token: "T", Amount: 4, Reverse: true, ExpiresAt: time.Date(2030, 1, 2, 3, 4, 5, 6, time.UTC)},
+        {},
+    }
+    data := IntentsToProto(intents)
+    got, err := IntentsFromProto(data)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !reflect.DeepEqual(got, intents) {
+        t.Errorf("round trip = %v, want %v", got, intents)
+    }
+    if empty, err := IntentsFromProto(IntentsToProto(nil)); err != nil || len(empty) != 0 {
+        t.Errorf("empty batch = %v, %v, want none", empty, err)
+    }
+}
+
+func TestIntentsProtoWireFormat(t *testing.T) {
+    // Hand-encoded IntentBatch{intents: [Intent{sender: "A", receiver: "B",
+    // token: "T", amount: 300}]}, with an unknown field 9 in the intent
+    data := []byte{
+        0x0a, 0x0e,
+        0x0a, 0x01, 'A',
+        0x12, 0x01, 'B',
+        0x1a, 0x01, 'T',
+        0x20, 0xac, 0x02,
+        0x48, 0x01,
+    }
+    got, err := IntentsFromProto(data)
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := []Intent{{Sender: "A", Receiver: "B", Token: "T", Amount: 300}}
+    if !reflect.DeepEqual(got, want) {
+        t.Errorf("IntentsFromProto = %v, want %v", got, want)
+    }
+    if enc := IntentsToProto(want); !bytes.Equal(enc, append([]byte{0x0a, 0x0c}, data[2:14]...)) {
+        t.Errorf("IntentsToProto = % x", enc)
+    }
+
+    for _, bad := range [][]byte{
+        {0x0a, 0x05, 0x0a},
+        {0x0a, 0x02, 0x20, 0x80},
+        {0x0a, 0x02, 0x22, 0x00},
+        {0x0a, 0x03, 0x0a, 0x01, 0xff},
+    } {
+        if _, err := IntentsFromProto(bad); !errors.Is(err, ErrMalformedProto) {
+            t.Errorf("IntentsFromProto(% x) error = %v, want ErrMalformedProto", bad, err)
+        }
+    }
+}
+
+func TestIntentsFromProtocEncoding(t *testing.T) {
+    // The bytes of
+    //
+    //  protoc --encode=netting.v1.IntentBatch proto/netting.proto <<EOF
+    //  intents {
+    //    sender: "alice" receiver: "bob" token: "USDC" amount: 1500000
+    //    id: "tx-1" refs: "inv-7" refs: "inv-9"
+    //  }
+    //  intents {
+    //    sender: "bob" receiver: "alice" token: "USDC" amount: 250
+    //    reverse: true expires_at: 1893456000000000000
+    //  }
+    //  intents {
+    //    sender: "carol" receiver: "alice" token: "ETH" amount: 1
+    //    expires_at: -1000000000
+    //  }
+    //  EOF
+    //
+    // derived by hand in the layout protoc writes, fields in number order
+    // and defaults left out, as protoc is not available to the tests
+    data := []byte{
+        0x0a, 0x2a,
+        0x0a, 0x05, 'a', 'l', 'i', 'c', 'e',
+        0x12, 0x03, 'b', 'o', 'b',
+        0x1a, 0x04, 'U', 'S', 'D', 'C',
+        0x20, 0xe0, 0xc6, 0x5b,
+        0x2a, 0x04, 't', 'x', '-', '1',
+        0x32, 0x05, 'i', 'n', 'v', '-', '7',
+        0x32, 0x05, 'i', 'n', 'v', '-', '9',
+
+        0x0a, 0x21,
+        0x0a, 0x03, 'b', 'o', 'b',
+        0x12, 0x05, 'a', 'l', 'i', 'c', 'e',
+        0x1a, 0x04, 'U', 'S', 'D', 'C',
+        0x20, 0xfa, 0x01,
+        0x38, 0x01,
+        0x40, 0x80, 0x80, 0xd4, 0xae, 0xb3, 0x86, 0xba, 0xa3, 0x1a,
+
+        0x0a, 0x20,
+        0x0a, 0x05, 'c', 'a', 'r', 'o', 'l',
+        0x12, 0x05, 'a', 'l', 'i', 'c', 'e',
+        0x1a, 0x03, 'E', 'T', 'H',
+        0x20, 0x01,
+        // A negative int64 is a ten-byte varint of its two's complement
+        0x40, 0x80, 0xec, 0x94, 0xa3, 0xfc, 0xff, 0xff, 0xff, 0xff, 0x01,
+    }
+    want := []Intent{
+        {Sender: "alice", Receiver: "bob", Token: "USDC", Amount: 1500000, ID: "tx-1", Refs: []string{"inv-7", "inv-9"}},
+        {Sender: "bob", Receiver: "alice", Token: "USDC", Amount: 250, Reverse: true, ExpiresAt: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)},
+        {Sender: "carol", Receiver: "alice", Token: "ETH", Amount: 1, ExpiresAt: time.Date(1969, 12, 31, 23, 59, 59, 0, time.UTC)},
+    }
+    got, err := IntentsFromProto(data)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !reflect.DeepEqual(got, want) {
+        t.Errorf("IntentsFromProto = %v, want %v", got, want)
+    }
+    if enc := IntentsToProto(want); !bytes.Equal(enc, data) {
+        t.Errorf("IntentsToProto = % x, want % x", enc, data)
+    }
+}
@@ -0,0 +1,91 @@
+package netting
+
+import (
+    "fmt"
+    "io"
+    "sort"
+    "strings"
+    "text/tabwriter"
+)
+
+// WriteReport writes a plain-text settlement report for operators comparing
+// the intents before netting with those after: the number of settlement
+// instructions, gross volume per token and each participant's net position
+// per token, with percentage reductions. Tokens and participants are listed
+// in sorted order. Both sets are validated as for ProcessNetting.
+func WriteReport(w io.Writer, before, after []Intent) error {
+    was, _, err := buildGraph(before)
+    if err != nil {
+        return fmt.Errorf("before: %w", err)
+    }
+    now, _, err := buildGraph(after)
+    if err != nil {
+        return fmt.Errorf("after: %w", err)
+    }
+    grossBefore, err := was.GrossByToken()
+    if err != nil {
+        return fmt.Errorf("before: %w", err)
+    }
+    grossAfter, err := now.GrossByToken()
+    if err != nil {
+        return fmt.Errorf("after: %w", err)
+    }
+    netBefore, err := intentPositions(before)
+    if err != nil {
+        return fmt.Errorf("before: %w", err)
+    }
+    netAfter, err := intentPositions(after)
+    if err != nil {
+        return fmt.Errorf("after: %w", err)
+    }
+
+    var b strings.Builder
+    fmt.Fprintf(&b, "Settlement instructions: %d before, %d after (%.1f%% fewer)\n\n",
+        len(before), len(after), reduction(float64(len(before)), float64(len(after))))
+
+    tw := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+    fmt.Fprintln(tw, "TOKEN\tGROSS BEFORE\tGROSS AFTER\tREDUCTION")
+    for _, token := range sortedKeys(grossBefore, grossAfter) {
+        fmt.Fprintf(tw, "%s\t%d\t%d\t%.1f%%\n", token, grossBefore[token], grossAfter[token],
+            reduction(float64(grossBefore[token]), float64(grossAfter[token])))
+    }
+    tw.Flush()
+    b.WriteString("\n")
+
+    fmt.Fprintln(tw, "PARTICIPANT\tTOKEN\tNET BEFORE\tNET AFTER")
+    nodes := make(map[string]bool)
+    for _, positions := range []map[string]map[string]int64{netBefore, netAfter} {
+        for node := range positions {
+            nodes[node] = true
+        }
+    }
+    for _, node := range sortedKeys(nodes) {
+        for _, token := range sortedKeys(netBefore[node], netAfter[node]) {
+            // Positions that are zero on both sides are left out
+            pre, post := netBefore[node][token], netAfter[node][token]
+            if pre != 0 || post != 0 {
+                fmt.Fprintf(tw, "%s\t%s\t%d\t%d\n", node, token, pre, post)
+            }
+        }
+    }
+    tw.Flush()
+
+    _, err = io.WriteString(w, b.String())
+    return err
+}
+
+// sortedKeys returns the keys present in any of maps, sorted
+func sortedKeys[V any](maps ...map[string]V) []string {
+    seen := make(map[string]bool)
+    keys := make([]string, 0)
+    for _, m := range maps {
+        for key := range m {
+            if !seen[key] {
+                seen[key] = true
+                keys = append(keys, key)
+            }
+        }
+    }
+    sort.Strings(keys)
+    return keys
+}
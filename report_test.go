@@ -0,0 +1,38 @@
+package netting
+
+import (
+    "bytes"
+    "testing"
+)
+
+func TestWriteReport(t *testing.T) {
+    before := append(triangle("T", 5),
+        Intent{Sender: "A", Receiver: "B", Token: "T", Amount: 3},
+        Intent{Sender: "A", Receiver: "C", Token: "U", Amount: 4},
+    )
+    after, err := ProcessNetting(before)
+    if err != nil {
+        t.Fatal(err)
+    }
+    var buf bytes.Buffer
+    if err := WriteReport(&buf, before, after); err != nil {
+        t.Fatal(err)
+    }
+
+    // C's T position is zero throughout, so it has no row
+    want := `Settlement instructions: 5 before, 2 after (60.0% fewer)
+
+TOKEN  GROSS BEFORE  GROSS AFTER  REDUCTION
+T      18            3            83.3%
+U      4             4            0.0%
+
+PARTICIPANT  TOKEN  NET BEFORE  NET AFTER
+A            T      -3          -3
+A            U      -4          -4
+B            T      3           3
+C            U      4           4
+`
+    if got := buf.String(); got != want {
+        t.Errorf("report =\n%s\nwant\n%s", got, want)
+    }
+}
@@ -0,0 +1,42 @@
+package netting
+
+import "math"
+
+// EdgeKeyOf identifies the edge From -> To in Token
+type EdgeKeyOf[N comparable] struct {
+    From  N
+    To    N
+    Token string
+}
+
+// EdgeKey is an EdgeKeyOf with string participant identifiers
+type EdgeKey = EdgeKeyOf[string]
+
+// CalculateNettingRetaining is CalculateNetting where each edge of the cycle
+// must keep at least its amount in minRetain. Only the part of an edge above
+// its floor can be netted, so an edge at or below its floor makes the result
+// zero. Edges missing from minRetain have no floor.
+func (g *GraphOf[N]) CalculateNettingRetaining(cycle []N, token string, minRetain map[EdgeKeyOf[N]]uint64) (uint64, bool) {
+    minAmount := uint64(math.MaxUint64)
+
+    for i := 0; i < len(cycle); i++ {
+        from := cycle[i]
+        to := cycle[(i+1)%len(cycle)]
+
+        amount, found := g.GetEdge(from, to, token)
+        if !found {
+            return 0, false
+        }
+        floor := minRetain[EdgeKeyOf[N]{From: from, To: to, Token: token}]
+        if amount <= floor {
+            amount = 0
+        } else {
+            amount -= floor
+        }
+        if amount < minAmount {
+            minAmount = amount
+        }
+    }
+
+    return minAmount, len(cycle) > 0
+}
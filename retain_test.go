@@ -0,0 +1,30 @@
+package netting
+
+import "testing"
+
+func TestMinRetain(t *testing.T) {
+    // B -> C must keep 3 owing, so only 7 of the triangle can net
+    opts := Options{MinRetain: map[EdgeKey]uint64{{From: "B", To: "C", Token: "T"}: 3}}
+    out, err := ProcessNettingWithOptions(triangle("T", 10), opts)
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := []Intent{
+        {Sender: "A", Receiver: "B", Token: "T", Amount: 3},
+        {Sender: "B", Receiver: "C", Token: "T", Amount: 3},
+        {Sender: "C", Receiver: "A", Token: "T", Amount: 3},
+    }
+    if !IntentsEqual(out, want) {
+        t.Errorf("residual = %v, want %v", out, want)
+    }
+
+    // A floor above the edge keeps the cycle out of netting
+    opts.MinRetain[EdgeKey{From: "B", To: "C", Token: "T"}] = 20
+    out, err = ProcessNettingWithOptions(triangle("T", 10), opts)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !IntentsEqual(out, triangle("T", 10)) {
+        t.Errorf("residual = %v, want the triangle unchanged", out)
+    }
+}
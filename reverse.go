@@ -0,0 +1,70 @@
+package netting
+
+// EnableReverseIndex starts maintaining an index of incoming edges so that
+// InEdges does not have to scan the whole graph. The index is built from the
+// current edges and kept up to date by every later mutation.
+func (g *GraphOf[N]) EnableReverseIndex() {
+    if g.reverse != nil {
+        return
+    }
+    g.reverse = make(map[N][]EdgeOf[N])
+    for _, from := range g.sources() {
+        for _, edge := range g.Edges[from] {
+            g.reverse[edge.To] = append(g.reverse[edge.To], EdgeOf[N]{To: from, Token: edge.Token, Amount: edge.Amount})
+        }
+    }
+}
+
+// InEdges returns the debts owed to node. In the returned edges To holds the
+// debtor rather than node itself. Without a reverse index this scans every
+// edge in the graph.
+func (g *GraphOf[N]) InEdges(node N) []EdgeOf[N] {
+    if g.reverse != nil {
+        in := make([]EdgeOf[N], len(g.reverse[node]))
+        copy(in, g.reverse[node])
+        return in
+    }
+
+    in := make([]EdgeOf[N], 0)
+    for _, from := range g.sources() {
+        for _, edge := range g.Edges[from] {
+            if edge.To == node {
+                in = append(in, EdgeOf[N]{To: from, Token: edge.Token, Amount: edge.Amount})
+            }
+        }
+    }
+    return in
+}
+
+// syncReverse records amount for the edge from -> to in token in the reverse
+// index, adding the entry if needed
+func (g *GraphOf[N]) syncReverse(from, to N, token string, amount uint64) {
+    if g.reverse == nil {
+        return
+    }
+    for i, edge := range g.reverse[to] {
+        if edge.To == from && edge.Token == token {
+            g.reverse[to][i].Amount = amount
+            return
+        }
+    }
+    g.reverse[to] = append(g.reverse[to], EdgeOf[N]{To: from, Token: token, Amount: amount})
+}
+
+// dropReverse removes the edge from -> to in token from the reverse index
+func (g *GraphOf[N]) dropReverse(from, to N, token string) {
+    if g.reverse == nil {
+        return
+    }
+    edges := g.reverse[to]
+    for i, edge := range edges {
+        if edge.To == from && edge.Token == token {
+            if len(edges) == 1 {
+                delete(g.reverse, to)
+            } else {
+                g.reverse[to] = append(edges[:i], edges[i+1:]...)
+            }
+            return
+        }
+    }
+}
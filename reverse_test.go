@@ -0,0 +1,57 @@
+package netting
+
+import (
+    "fmt"
+    "math/rand"
+    "sort"
+    "testing"
+)
+
+// sortedEdges returns a copy of edges sorted by To and Token
+func sortedEdges(edges []Edge) []Edge {
+    edges = append([]Edge(nil), edges...)
+    sort.Slice(edges, func(i, j int) bool {
+        if edges[i].To != edges[j].To {
+            return edges[i].To < edges[j].To
+        }
+        return edges[i].Token < edges[j].Token
+    })
+    return edges
+}
+
+func TestReverseIndexConsistent(t *testing.T) {
+    r := rand.New(rand.NewSource(1))
+    g := NewGraph()
+    g.EnableReverseIndex()
+    node := func() string { return fmt.Sprint(r.Intn(6)) }
+    for step := 0; step < 2000; step++ {
+        from, to, token := node(), node(), fmt.Sprint(r.Intn(2))
+        if from == to {
+            continue
+        }
+        switch r.Intn(3) {
+        case 0, 1:
+            if err := g.AddEdge(from, to, token, uint64(1+r.Intn(10))); err != nil {
+                t.Fatal(err)
+            }
+        case 2:
+            g.RemoveEdge(from, to, token)
+        }
+        if amount, ok := g.GetEdge(from, to, token); ok && r.Intn(4) == 0 {
+            if back, ok := g.GetEdge(to, from, token); ok {
+                g.ApplyNetting([]string{from, to}, token, min(amount, back))
+            }
+        }
+
+        // The index must match what a scan finds
+        plain := g.Clone()
+        plain.reverse = nil
+        for i := 0; i < 6; i++ {
+            n := fmt.Sprint(i)
+            got, want := sortedEdges(g.InEdges(n)), sortedEdges(plain.InEdges(n))
+            if fmt.Sprint(got) != fmt.Sprint(want) {
+                t.Fatalf("step %d: InEdges(%s) = %v, want %v", step, n, got, want)
+            }
+        }
+    }
+}
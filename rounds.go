@@ -0,0 +1,72 @@
+package netting
+
+import (
+    "context"
+    "fmt"
+    "sync"
+)
+
+// RoundEngine nets in discrete settlement rounds. The residual debts left
+// by one round carry over and are netted again together with the next
+// round's intents, so debts that could not net on their own may close
+// cycles later. It is safe for concurrent use.
+type RoundEngine struct {
+    mu       sync.Mutex
+    residual *Graph
+    opts     Options
+}
+
+// NewRoundEngine returns a round engine with no residual debts that nets
+// with opts
+func NewRoundEngine(opts Options) (*RoundEngine, error) {
+    opts, err := opts.withDefaults()
+    if err != nil {
+        return nil, err
+    }
+    return &RoundEngine{residual: NewGraph(), opts: opts}, nil
+}
+
+// Round adds intents to the residual debts, nets the result and returns
+// what remains, which is also what the next round starts from. Reversals
+// cancel residual debt as well as debt added earlier in the round. If any
+// intent is invalid, or adding them would overflow an edge, take it past
+// its Options.CreditLimits entry or reverse more than is owed, the round is
+// rejected and the residual is left unchanged.
+func (e *RoundEngine) Round(intents []Intent) ([]Intent, error) {
+    for i, intent := range intents {
+        if err := validateIntent(intent); err != nil {
+            return nil, fmt.Errorf("intent %d: %w", i, err)
+        }
+    }
+
+    e.mu.Lock()
+    defer e.mu.Unlock()
+
+    // Work on a copy so a rejected round leaves no trace
+    next := e.residual.Clone()
+    for i, intent := range intents {
+        if intent.Sender == intent.Receiver {
+            continue
+        }
+        if !intent.Reverse {
+            if err := next.checkCredit(e.opts.CreditLimits, intent.Sender, intent.Receiver, intent.Token, intent.Amount); err != nil {
+                return nil, fmt.Errorf("intent %d: %w", i, err)
+            }
+        }
+        if err := next.addIntent(intent); err != nil {
+            return nil, fmt.Errorf("intent %d: %w", i, err)
+        }
+    }
+    if _, _, err := next.netCycles(context.Background(), e.opts); err != nil {
+        return nil, err
+    }
+    e.residual = next
+    return next.ToIntents(), nil
+}
+
+// Residual returns the debts carried into the next round
+func (e *RoundEngine) Residual() []Intent {
+    e.mu.Lock()
+    defer e.mu.Unlock()
+    return e.residual.ToIntents()
+}
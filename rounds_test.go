@@ -0,0 +1,39 @@
+package netting
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestRoundEngineCarryOver(t *testing.T) {
+    e, err := NewRoundEngine(Options{})
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    // A chain has nothing to net on its own, so all of it carries over
+    first := []Intent{
+        {Sender: "A", Receiver: "B", Token: "T", Amount: 10},
+        {Sender: "B", Receiver: "C", Token: "T", Amount: 10},
+    }
+    out, err := e.Round(first)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !reflect.DeepEqual(out, first) {
+        t.Fatalf("round 1 = %v, want %v", out, first)
+    }
+
+    // C -> A closes the triangle with the carried-over chain
+    out, err = e.Round([]Intent{{Sender: "C", Receiver: "A", Token: "T", Amount: 4}})
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := []Intent{
+        {Sender: "A", Receiver: "B", Token: "T", Amount: 6},
+        {Sender: "B", Receiver: "C", Token: "T", Amount: 6},
+    }
+    if !reflect.DeepEqual(out, want) {
+        t.Errorf("round 2 = %v, want %v", out, want)
+    }
+}
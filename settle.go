@@ -0,0 +1,236 @@
+package netting
+
+import (
+    "cmp"
+    "math"
+    "math/big"
+    "math/bits"
+    "sort"
+)
+
+// magnitude returns |pos| as a uint64, which is exact even for MinInt64
+func magnitude(pos int64) uint64 {
+    if pos < 0 {
+        return uint64(-(pos + 1)) + 1
+    }
+    return uint64(pos)
+}
+
+// SettleNetPositions turns signed net positions for one token into transfers
+// from net debtors (negative positions) to net creditors (positive ones).
+// Debtors and creditors are each sorted largest first and matched greedily,
+// so every transfer settles at least one side in full and there are fewer
+// transfers than participants with a nonzero position. The positions should
+// sum to zero; any excess on one side is left without a transfer.
+func SettleNetPositions(net map[string]int64, token string) []Intent {
+    type party struct {
+        node   string
+        amount uint64
+    }
+    var debtors, creditors []party
+    for node, pos := range net {
+        switch {
+        case pos < 0:
+            debtors = append(debtors, party{node, magnitude(pos)})
+        case pos > 0:
+            creditors = append(creditors, party{node, magnitude(pos)})
+        }
+    }
+    byAmount := func(parties []party) {
+        sort.Slice(parties, func(i, j int) bool {
+            if parties[i].amount != parties[j].amount {
+                return parties[i].amount > parties[j].amount
+            }
+            return parties[i].node < parties[j].node
+        })
+    }
+    byAmount(debtors)
+    byAmount(creditors)
+
+    transfers := make([]Intent, 0)
+    for i, j := 0, 0; i < len(debtors) && j < len(creditors); {
+        amount := debtors[i].amount
+        if creditors[j].amount < amount {
+            amount = creditors[j].amount
+        }
+        transfers = append(transfers, Intent{
+            Sender:    debtors[i].node,
+            Receiver:  creditors[j].node,
+            Token:     token,
+            Amount:    amount,
+        })
+
+        debtors[i].amount -= amount
+        creditors[j].amount -= amount
+        if debtors[i].amount == 0 {
+            i++
+        }
+        if creditors[j].amount == 0 {
+            j++
+        }
+    }
+    return transfers
+}
+
+// MinimizeTransactions ignores the shape of the debt graph and settles each
+// token from net positions alone: every participant's net balance is
+// computed and net debtors pay net creditors directly. This needs at most
+// one fewer transfer than there are participants with a nonzero balance,
+// usually far fewer than cycle netting leaves behind, but the transfers may
+// be between parties that had no direct debt.
+func MinimizeTransactions(intents []Intent) ([]Intent, error) {
+    g, _, err := buildGraph(intents)
+    if err != nil {
+        return nil, err
+    }
+    positions, err := g.NetPositions()
+    if err != nil {
+        return nil, err
+    }
+
+    // Regroup positions by token
+    byToken := make(map[string]map[string]int64)
+    for node, tokens := range positions {
+        for token, pos := range tokens {
+            if byToken[token] == nil {
+                byToken[token] = make(map[string]int64)
+            }
+            byToken[token][node] = pos
+        }
+    }
+
+    transfers := make([]Intent, 0)
+    for token, net := range byToken {
+        transfers = append(transfers, SettleNetPositions(net, token)...)
+    }
+    sortIntents(transfers, cmp.Compare[string])
+    return transfers, nil
+}
+
+// exactEstimateLimit is the most participants with a nonzero balance for
+// which MinTransactionsEstimate searches for the exact minimum
+const exactEstimateLimit = 16
+
+// minTransfers returns the fewest transfers that settle the signed balances
+// in net, none of which may be zero. Participants can be split into groups
+// that each sum to zero and settle alone, a group of k needing k-1
+// transfers, so the minimum is len(net) minus the most such groups. That
+// search is exponential, so beyond exactEstimateLimit participants, or if
+// subset sums could overflow, a single group is assumed, which greedy
+// settlement always achieves.
+func minTransfers(net []int64) int {
+    n := len(net)
+    if n == 0 {
+        return 0
+    }
+    var total uint64
+    for _, pos := range net {
+        if total > math.MaxInt64-magnitude(pos) {
+            return n - 1
+        }
+        total += magnitude(pos)
+    }
+    if n > exactEstimateLimit {
+        return n - 1
+    }
+
+    // groups[mask] is the most zero-sum groups the participants in mask can
+    // be split into, counting a last group that need not sum to zero
+    sums := make([]int64, 1<<n)
+    groups := make([]int, 1<<n)
+    for mask := 1; mask < 1<<n; mask++ {
+        low := bits.TrailingZeros(uint(mask))
+        sums[mask] = sums[mask&(mask-1)] + net[low]
+        best := 0
+        for i := 0; i < n; i++ {
+            if mask&(1<<i) != 0 && groups[mask&^(1<<i)] > best {
+                best = groups[mask&^(1<<i)]
+            }
+        }
+        if sums[mask] == 0 {
+            best++
+        }
+        groups[mask] = best
+    }
+    return n - groups[1<<n-1]
+}
+
+// MinTransactionsEstimate returns, per token, the fewest transfers that
+// could settle intents if any participant may pay any other, the floor that
+// MinimizeTransactions and cycle netting can be compared against. It is
+// exact for up to 16 participants with a nonzero balance in a token and an
+// upper bound, one fewer than their number, beyond that. Tokens in which
+// every balance is zero map to 0.
+func MinTransactionsEstimate(intents []Intent) (map[string]int, error) {
+    g, _, err := buildGraph(intents)
+    if err != nil {
+        return nil, err
+    }
+    positions, err := g.NetPositions()
+    if err != nil {
+        return nil, err
+    }
+
+    // Collect nonzero balances per token; their order does not matter
+    byToken := make(map[string][]int64)
+    for _, tokens := range positions {
+        for token, pos := range tokens {
+            if _, ok := byToken[token]; !ok {
+                byToken[token] = nil
+            }
+            if pos != 0 {
+                byToken[token] = append(byToken[token], pos)
+            }
+        }
+    }
+
+    estimates := make(map[string]int, len(byToken))
+    for token, net := range byToken {
+        estimates[token] = minTransfers(net)
+    }
+    return estimates, nil
+}
+
+// MinVolumeBound returns, per token, the least total volume any settlement
+// of intents can move: the sum of the positive net balances, since every
+// net creditor must receive at least its balance. It is what
+// MinimizeTransactions moves, and residual volume after cycle netting can be
+// compared against it. Intents are taken as given, self-loops and reversals
+// included, without validation. Balances are summed exactly, and a bound
+// too large for a uint64 is reported as math.MaxUint64.
+func MinVolumeBound(intents []Intent) map[string]uint64 {
+    balances := make(map[string]map[string]*big.Int)
+    add := func(token, node string, amount *big.Int) {
+        if balances[token] == nil {
+            balances[token] = make(map[string]*big.Int)
+        }
+        if balances[token][node] == nil {
+            balances[token][node] = new(big.Int)
+        }
+        balances[token][node].Add(balances[token][node], amount)
+    }
+    for _, intent := range intents {
+        amount := new(big.Int).SetUint64(intent.Amount)
+        if intent.Reverse {
+            amount.Neg(amount)
+        }
+        add(intent.Token, intent.Receiver, amount)
+        add(intent.Token, intent.Sender, new(big.Int).Neg(amount))
+    }
+
+    bounds := make(map[string]uint64, len(balances))
+    for token, nodes := range balances {
+        total := new(big.Int)
+        for _, balance := range nodes {
+            if balance.Sign() > 0 {
+                total.Add(total, balance)
+            }
+        }
+        if total.IsUint64() {
+            bounds[token] = total.Uint64()
+        } else {
+            bounds[token] = math.MaxUint64
+        }
+    }
+    return bounds
+}
@@ -0,0 +1,126 @@
+package netting
+
+import (
+    "math"
+    "math/rand"
+    "reflect"
+    "testing"
+)
+
+func TestMinimizeTransactions(t *testing.T) {
+    // A chain has no cycle to net, but A can pay C directly
+    chain := []Intent{
+        {Sender: "A", Receiver: "B", Token: "T", Amount: 10},
+        {Sender: "B", Receiver: "C", Token: "T", Amount: 10},
+    }
+    netted, err := ProcessNetting(chain)
+    if err != nil {
+        t.Fatal(err)
+    }
+    minimal, err := MinimizeTransactions(chain)
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := []Intent{{Sender: "A", Receiver: "C", Token: "T", Amount: 10}}
+    if len(netted) != 2 || !IntentsEqual(minimal, want) {
+        t.Errorf("cycle netting left %v and MinimizeTransactions %v, want 2 and %v", netted, minimal, want)
+    }
+
+    r := rand.New(rand.NewSource(1))
+    for trial := 0; trial < 50; trial++ {
+        intents := randomIntents(r, 10, 2, 40)
+        netted, err := ProcessNetting(intents)
+        if err != nil {
+            t.Fatal(err)
+        }
+        minimal, err := MinimizeTransactions(intents)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if len(minimal) > len(netted) {
+            t.Errorf("trial %d: %d transfers, more than the %d cycle netting left", trial, len(minimal), len(netted))
+        }
+        if err := VerifyConservation(intents, minimal); err != nil {
+            t.Errorf("trial %d: %v", trial, err)
+        }
+    }
+}
+
+func TestMinTransactionsEstimate(t *testing.T) {
+    intents := []Intent{
+        // Two pairs that each settle alone: 2, not 3
+        {Sender: "A", Receiver: "B", Token: "T", Amount: 10},
+        {Sender: "C", Receiver: "D", Token: "T", Amount: 5},
+        // A chain A -10, B +4, C +6: 2
+        {Sender: "A", Receiver: "B", Token: "U", Amount: 10},
+        {Sender: "B", Receiver: "C", Token: "U", Amount: 6},
+    }
+    // A balanced triangle: nothing to settle
+    intents = append(intents, triangle("V", 5)...)
+
+    got, err := MinTransactionsEstimate(intents)
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := map[string]int{"T": 2, "U": 2, "V": 0}
+    if !reflect.DeepEqual(got, want) {
+        t.Errorf("MinTransactionsEstimate = %v, want %v", got, want)
+    }
+}
+
+func TestSettleNetPositions(t *testing.T) {
+    net := map[string]int64{"A": -30, "B": -10, "C": 25, "D": 15}
+    transfers := SettleNetPositions(net, "T")
+
+    // The largest debtor pays the largest creditor first
+    want := []Intent{
+        {Sender: "A", Receiver: "C", Token: "T", Amount: 25},
+        {Sender: "A", Receiver: "D", Token: "T", Amount: 5},
+        {Sender: "B", Receiver: "D", Token: "T", Amount: 10},
+    }
+    if !IntentsEqual(transfers, want) {
+        t.Errorf("SettleNetPositions = %v, want %v", transfers, want)
+    }
+
+    got := make(map[string]int64)
+    for _, transfer := range transfers {
+        got[transfer.Sender] -= int64(transfer.Amount)
+        got[transfer.Receiver] += int64(transfer.Amount)
+    }
+    if !reflect.DeepEqual(got, net) {
+        t.Errorf("transfers leave positions %v, want %v", got, net)
+    }
+}
+
+func TestMinVolumeBound(t *testing.T) {
+    intents := []Intent{
+        // a -7, b +6, c +1
+        {Sender: "a", Receiver: "b", Token: "X", Amount: 10},
+        {Sender: "b", Receiver: "c", Token: "X", Amount: 4},
+        {Sender: "c", Receiver: "a", Token: "X", Amount: 3},
+        // A reversal leaves P owing Q 5; the self-loop moves nothing
+        {Sender: "P", Receiver: "Q", Token: "Y", Amount: 8},
+        {Sender: "P", Receiver: "Q", Token: "Y", Amount: 3, Reverse: true},
+        {Sender: "Q", Receiver: "Q", Token: "Y", Amount: 100},
+        // Twice the largest amount saturates
+        {Sender: "A", Receiver: "B", Token: "Z", Amount: math.MaxUint64},
+        {Sender: "C", Receiver: "D", Token: "Z", Amount: math.MaxUint64},
+    }
+    want := map[string]uint64{"X": 7, "Y": 5, "Z": math.MaxUint64}
+    if got := MinVolumeBound(intents); !reflect.DeepEqual(got, want) {
+        t.Errorf("MinVolumeBound = %v, want %v", got, want)
+    }
+
+    // Cycle netting leaves a -> b 7 and b -> c 1, above the bound
+    out, err := ProcessNetting(intents[:3])
+    if err != nil {
+        t.Fatal(err)
+    }
+    var volume uint64
+    for _, intent := range out {
+        volume += intent.Amount
+    }
+    if volume != 8 {
+        t.Errorf("netted volume = %d, want 8", volume)
+    }
+}
@@ -0,0 +1,129 @@
+package netting
+
+import (
+    "context"
+    "sort"
+)
+
+// ShortestCycleThrough returns a cycle through node with the fewest hops
+// using only edges in token, starting at node, and false if there is none.
+// It runs a breadth-first search, so unlike FindCycles its cost stays linear
+// in the size of the graph however dense the SCC.
+func (g *GraphOf[N]) ShortestCycleThrough(node N, token string) ([]N, bool) {
+    return g.shortestCycle(node, token, nil)
+}
+
+// shortestCycle is ShortestCycleThrough restricted to the edges from -> to
+// that skip, if set, does not rule out
+func (g *GraphOf[N]) shortestCycle(node N, token string, skip func(from, to N) bool) ([]N, bool) {
+    parent := map[N]N{node: node}
+    queue := []N{node}
+    for len(queue) > 0 {
+        v := queue[0]
+        queue = queue[1:]
+        for _, edge := range g.Edges[v] {
+            if edge.Token != token || (skip != nil && skip(v, edge.To)) {
+                continue
+            }
+            if edge.To == node {
+                // Walk back to node; the first hop closing a cycle is on a
+                // shortest one since nodes leave the queue in BFS order
+                cycle := []N{v}
+                for u := v; u != node; {
+                    u = parent[u]
+                    cycle = append(cycle, u)
+                }
+                for i, j := 0, len(cycle)-1; i < j; i, j = i+1, j-1 {
+                    cycle[i], cycle[j] = cycle[j], cycle[i]
+                }
+                return cycle, true
+            }
+            if _, seen := parent[edge.To]; !seen {
+                parent[edge.To] = v
+                queue = append(queue, edge.To)
+            }
+        }
+    }
+    return nil, false
+}
+
+// netShortest nets greedily without enumerating cycles: for each token and
+// node in order it repeatedly nets the shortest cycle through the node until
+// none within opts.MaxCycleLength is left. Netting only removes debt, so no
+// cycle through a node appears once it has been exhausted, and one pass
+// suffices. Edges at or below their MinRetain floor are ignored, so every
+// step zeroes the nettable part of at least one edge, as are edges between
+// forbidden pairs and those with less than MinNetAmount to give.
+// MustSettle participants are searched from first.
+func (g *GraphOf[N]) netShortest(ctx context.Context, opts OptionsOf[N]) ([]NettingOpOf[N], error) {
+    nodes := g.sources()
+    if opts.mustSettle != nil {
+        sort.SliceStable(nodes, func(i, j int) bool {
+            return opts.mustSettle[nodes[i]] && !opts.mustSettle[nodes[j]]
+        })
+    }
+
+    seen := make(map[string]bool)
+    tokens := make([]string, 0)
+    for _, from := range nodes {
+        for _, edge := range g.Edges[from] {
+            if !seen[edge.Token] && opts.nets(edge.Token) {
+                seen[edge.Token] = true
+                tokens = append(tokens, edge.Token)
+            }
+        }
+    }
+    sort.Strings(tokens)
+
+    maxLength := opts.MaxCycleLength
+    if opts.MaxParticipants > 0 && opts.MaxParticipants < maxLength {
+        maxLength = opts.MaxParticipants
+    }
+
+    ops := make([]NettingOpOf[N], 0)
+    steps := 0
+    for _, token := range tokens {
+        var skip func(from, to N) bool
+        if opts.MinRetain != nil || opts.forbidden != nil || opts.MinNetAmount > 0 {
+            skip = func(from, to N) bool {
+                if opts.forbidden[[2]N{from, to}] {
+                    return true
+                }
+                // A cycle nets the least any of its edges can give, so an
+                // edge giving less than MinNetAmount rules out every cycle
+                // through it
+                amount, _ := g.GetEdge(from, to, token)
+                floor := opts.MinRetain[EdgeKeyOf[N]{From: from, To: to, Token: token}]
+                return amount <= floor || amount-floor < opts.MinNetAmount
+            }
+        }
+
+        for _, node := range nodes {
+            for {
+                steps++
+                if steps%ctxCheckInterval == 0 {
+                    if err := ctx.Err(); err != nil {
+                        return ops, err
+                    }
+                }
+
+                cycle, ok := g.shortestCycle(node, token, skip)
+                if !ok || len(cycle) > maxLength {
+                    break
+                }
+                if opts.OnCycleFound != nil {
+                    opts.OnCycleFound(append([]N(nil), cycle...))
+                }
+                amount, _ := g.CalculateNettingRetaining(cycle, token, opts.MinRetain)
+                if err := g.ApplyNetting(cycle, token, amount); err != nil {
+                    return ops, err
+                }
+
+                op := NettingOpOf[N]{Cycle: g.canonicalCycle(cycle), Token: token, Amount: amount}
+                opts.applied(op)
+                ops = append(ops, op)
+            }
+        }
+    }
+    return ops, nil
+}
@@ -0,0 +1,48 @@
+package netting
+
+import (
+    "context"
+    "reflect"
+    "testing"
+)
+
+func TestShortestCycleThrough(t *testing.T) {
+    // The capped search starts from the last node Tarjan's algorithm
+    // reached, G, so it meets the 4-cycle before the 3-cycle through A
+    intents := []Intent{
+        {Sender: "A", Receiver: "B", Token: "T", Amount: 5},
+        {Sender: "B", Receiver: "C", Token: "T", Amount: 5},
+        {Sender: "C", Receiver: "A", Token: "T", Amount: 5},
+        {Sender: "A", Receiver: "E", Token: "T", Amount: 5},
+        {Sender: "E", Receiver: "F", Token: "T", Amount: 5},
+        {Sender: "F", Receiver: "G", Token: "T", Amount: 5},
+        {Sender: "G", Receiver: "A", Token: "T", Amount: 5},
+    }
+    g, _, err := buildGraph(intents)
+    if err != nil {
+        t.Fatal(err)
+    }
+    first, err := g.findCycles(context.Background(), g.FindSCCs()[0], DefaultMaxCycleLength, 1)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(first) != 1 || len(first[0]) != 4 {
+        t.Fatalf("capped search found %v, want the 4-cycle", first)
+    }
+
+    cycle, ok := g.ShortestCycleThrough("A", "T")
+    if want := []string{"A", "B", "C"}; !ok || !reflect.DeepEqual(cycle, want) {
+        t.Errorf("ShortestCycleThrough(A) = %v, %v, want %v", cycle, ok, want)
+    }
+    if _, ok := g.ShortestCycleThrough("A", "U"); ok {
+        t.Error("found a cycle in a token with no edges")
+    }
+
+    out, err := ProcessNettingWithOptions(intents, Options{ShortestCycles: true})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(out) != 0 {
+        t.Errorf("ShortestCycles left %v, want nothing", out)
+    }
+}
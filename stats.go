@@ -0,0 +1,129 @@
+package netting
+
+import (
+    "context"
+    "fmt"
+    "math"
+)
+
+// Stats describes how much a netting run reduced its input
+type Stats struct {
+    // IntentsBefore is the number of intents passed in and IntentsAfter the
+    // number of intents returned
+    IntentsBefore int
+    IntentsAfter  int
+
+    // GrossBefore and GrossAfter hold the total amount owed per token
+    GrossBefore map[string]uint64
+    GrossAfter  map[string]uint64
+
+    // SelfLoopsDropped counts intents whose sender was also the receiver.
+    // They are discarded before netting and excluded from the gross totals.
+    SelfLoopsDropped int
+
+    // ExpiredDropped counts intents that had expired at Options.Now. They
+    // are discarded before netting and excluded from the gross totals.
+    ExpiredDropped int
+
+    // Unsettled holds the debts left owed by or to Options.MustSettle
+    // participants, sorted by sender, receiver and token
+    Unsettled []Intent
+
+    // Truncated is set when the Options budget or cycle cap stopped netting
+    // before every cycle was considered, so more could have been netted
+    Truncated bool
+}
+
+// reduction returns the percentage by which after is smaller than before
+func reduction(before, after float64) float64 {
+    if before == 0 {
+        return 0
+    }
+    return (before - after) / before * 100
+}
+
+// CountReduction returns the percentage reduction in the number of intents
+func (s Stats) CountReduction() float64 {
+    return reduction(float64(s.IntentsBefore), float64(s.IntentsAfter))
+}
+
+// VolumeReduction returns the percentage reduction in gross volume for token
+func (s Stats) VolumeReduction(token string) float64 {
+    return reduction(float64(s.GrossBefore[token]), float64(s.GrossAfter[token]))
+}
+
+// GrossByToken returns the total amount owed per token across all edges.
+// ErrAmountOverflow is returned if a total does not fit in a uint64.
+func (g *GraphOf[N]) GrossByToken() (map[string]uint64, error) {
+    gross := make(map[string]uint64)
+    for _, edges := range g.Edges {
+        for _, edge := range edges {
+            if gross[edge.Token] > math.MaxUint64-edge.Amount {
+                return nil, fmt.Errorf("gross %s volume: %w", edge.Token, ErrAmountOverflow)
+            }
+            gross[edge.Token] += edge.Amount
+        }
+    }
+    return gross, nil
+}
+
+// ProcessNettingWithStats is ProcessNetting that also reports how effective
+// the netting was
+func ProcessNettingWithStats(intents []Intent) ([]Intent, Stats, error) {
+    return ProcessNettingWithStatsOptions(intents, Options{})
+}
+
+// ProcessNettingWithStatsOptions is ProcessNettingWithStats tuned by opts
+func ProcessNettingWithStatsOptions(intents []Intent, opts Options) ([]Intent, Stats, error) {
+    opts, err := opts.withDefaults()
+    if err != nil {
+        return nil, Stats{}, err
+    }
+
+    live, expired, err := opts.live(intents)
+    if err != nil {
+        return nil, Stats{}, err
+    }
+    g, selfLoops, err := buildGraph(live)
+    if err != nil {
+        return nil, Stats{}, err
+    }
+
+    // Totals come from the graph so they match the edges that are netted
+    stats := Stats{IntentsBefore: len(intents), SelfLoopsDropped: selfLoops, ExpiredDropped: expired}
+    if stats.GrossBefore, err = g.GrossByToken(); err != nil {
+        return nil, Stats{}, err
+    }
+
+    _, truncated, err := g.netCycles(context.Background(), opts)
+    if err != nil {
+        return nil, Stats{}, err
+    }
+    stats.Truncated = truncated
+
+    if len(opts.MustSettle) > 0 {
+        stats.Unsettled = g.Unsettled(opts.MustSettle)
+    }
+
+    result := g.ToIntents()
+    stats.IntentsAfter = len(result)
+    // Netting only ever lowers amounts, so this cannot overflow
+    stats.GrossAfter, _ = g.GrossByToken()
+    return result, stats, nil
+}
+
+// Unsettled returns the debts in g owed by or to any of nodes, sorted by
+// sender, receiver and token
+func (g *GraphOf[N]) Unsettled(nodes []N) []IntentOf[N] {
+    settle := make(map[N]bool, len(nodes))
+    for _, node := range nodes {
+        settle[node] = true
+    }
+    unsettled := make([]IntentOf[N], 0)
+    for _, intent := range g.ToIntents() {
+        if settle[intent.Sender] || settle[intent.Receiver] {
+            unsettled = append(unsettled, intent)
+        }
+    }
+    return unsettled
+}
@@ -0,0 +1,64 @@
+package netting
+
+import (
+    "container/heap"
+    "math"
+)
+
+// reach is a node and the width of a path found to it
+type reach[N comparable] struct {
+    node  N
+    width uint64
+}
+
+// widest is a max-heap of paths by width
+type widest[N comparable] []reach[N]
+
+func (h widest[N]) Len() int           { return len(h) }
+func (h widest[N]) Less(i, j int) bool { return h[i].width > h[j].width }
+func (h widest[N]) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *widest[N]) Push(x any)        { *h = append(*h, x.(reach[N])) }
+func (h *widest[N]) Pop() any {
+    r := (*h)[len(*h)-1]
+    *h = (*h)[:len(*h)-1]
+    return r
+}
+
+// TransitiveExposure returns, for every participant, how much of token it
+// can pass on to each participant reachable through its debts. The exposure
+// of a to c is the widest path from a to c: over every chain of debts
+// a -> ... -> c, the largest smallest hop, which is the most a single chain
+// could carry from a to c. So for A owing B 50 and B owing C 30, A's exposure
+// to C is 30; a direct debt counts as a chain of one hop. Participants are
+// absent from their own map, and only reachable participants are present.
+func (g *GraphOf[N]) TransitiveExposure(token string) map[N]map[N]uint64 {
+    exposure := make(map[N]map[N]uint64)
+    for _, source := range g.sources() {
+        // Dijkstra's algorithm with the smallest hop in place of the sum
+        width := map[N]uint64{source: math.MaxUint64}
+        done := make(map[N]bool)
+        h := &widest[N]{{source, math.MaxUint64}}
+        for h.Len() > 0 {
+            v := heap.Pop(h).(reach[N]).node
+            if done[v] {
+                continue
+            }
+            done[v] = true
+            for _, edge := range g.Edges[v] {
+                if edge.Token != token || done[edge.To] {
+                    continue
+                }
+                if w := min(width[v], edge.Amount); w > width[edge.To] {
+                    width[edge.To] = w
+                    heap.Push(h, reach[N]{edge.To, w})
+                }
+            }
+        }
+
+        delete(width, source)
+        if len(width) > 0 {
+            exposure[source] = width
+        }
+    }
+    return exposure
+}
@@ -0,0 +1,26 @@
+package netting
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestTransitiveExposureChain(t *testing.T) {
+    g := NewGraph()
+    g.AddEdge("A", "B", "T", 50)
+    g.AddEdge("B", "C", "T", 30)
+    g.AddEdge("C", "D", "T", 40)
+    // A narrower direct debt does not lower the chain through B
+    g.AddEdge("A", "C", "T", 10)
+    // Debts in other tokens are ignored
+    g.AddEdge("D", "A", "U", 99)
+
+    want := map[string]map[string]uint64{
+        "A": {"B": 50, "C": 30, "D": 30},
+        "B": {"C": 30, "D": 30},
+        "C": {"D": 40},
+    }
+    if got := g.TransitiveExposure("T"); !reflect.DeepEqual(got, want) {
+        t.Errorf("TransitiveExposure = %v, want %v", got, want)
+    }
+}
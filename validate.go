@@ -0,0 +1,42 @@
+package netting
+
+import (
+    "errors"
+    "fmt"
+)
+
+// Errors reported by Validate. Self-loops are reported with ErrSelfLoop.
+var (
+    ErrDuplicateEdge  = errors.New("duplicate edge")
+    ErrZeroEdge       = errors.New("zero-amount edge")
+    ErrEmptyAdjacency = errors.New("node has an empty edge list")
+)
+
+// Validate checks the invariants the graph methods maintain: every node in
+// Edges has at least one edge, and each edge has a distinct receiver and
+// token, a nonzero amount and a receiver other than its sender. It is meant
+// for catching direct changes to Edges that broke them. The first problem
+// found, in node order, is returned.
+func (g *GraphOf[N]) Validate() error {
+    for _, from := range g.sources() {
+        edges := g.Edges[from]
+        if len(edges) == 0 {
+            return fmt.Errorf("%v: %w", from, ErrEmptyAdjacency)
+        }
+
+        seen := make(map[edgeKey[N]]bool, len(edges))
+        for _, edge := range edges {
+            switch key := (edgeKey[N]{edge.To, edge.Token}); {
+            case edge.To == from:
+                return fmt.Errorf("edge %v -> %v %s: %w", from, edge.To, edge.Token, ErrSelfLoop)
+            case edge.Amount == 0:
+                return fmt.Errorf("edge %v -> %v %s: %w", from, edge.To, edge.Token, ErrZeroEdge)
+            case seen[key]:
+                return fmt.Errorf("edge %v -> %v %s: %w", from, edge.To, edge.Token, ErrDuplicateEdge)
+            default:
+                seen[key] = true
+            }
+        }
+    }
+    return nil
+}
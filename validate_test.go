@@ -0,0 +1,40 @@
+package netting
+
+import (
+    "errors"
+    "testing"
+)
+
+func TestValidate(t *testing.T) {
+    valid := func() *Graph {
+        g, _, err := buildGraph(triangle("T", 5))
+        if err != nil {
+            t.Fatal(err)
+        }
+        return g
+    }
+    if err := valid().Validate(); err != nil {
+        t.Fatalf("valid graph: %v", err)
+    }
+
+    for _, tt := range []struct {
+        name    string
+        corrupt func(g *Graph)
+        want    error
+    }{
+        {"duplicate", func(g *Graph) {
+            g.Edges["A"] = append(g.Edges["A"], Edge{To: "B", Token: "T", Amount: 1})
+        }, ErrDuplicateEdge},
+        {"zero", func(g *Graph) { g.Edges["B"][0].Amount = 0 }, ErrZeroEdge},
+        {"self-loop", func(g *Graph) {
+            g.Edges["C"] = append(g.Edges["C"], Edge{To: "C", Token: "T", Amount: 1})
+        }, ErrSelfLoop},
+        {"empty adjacency", func(g *Graph) { g.Edges["D"] = nil }, ErrEmptyAdjacency},
+    } {
+        g := valid()
+        tt.corrupt(g)
+        if err := g.Validate(); !errors.Is(err, tt.want) {
+            t.Errorf("%s: Validate = %v, want %v", tt.name, err, tt.want)
+        }
+    }
+}